@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+)
+
+var (
+	contextTunnels []string
+	contextRefresh time.Duration
+
+	getContextsOutput   string
+	getContextsSelector string
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage contexts in the config file",
+	Long: `Manage contexts, which bundle a bastion with the tunnel profiles to open and
+the settings to use with it, like kubectl contexts. The current context is
+used whenever --bastion isn't given; --context picks another one for a
+single run.`,
+}
+
+// getContextsCmd represents the config get-contexts command
+var getContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List all contexts",
+	Args:  cobra.NoArgs,
+	RunE:  runGetContexts,
+}
+
+// currentContextCmd represents the config current-context command
+var currentContextCmd = &cobra.Command{
+	Use:   "current-context",
+	Short: "Print the current context",
+	Args:  cobra.NoArgs,
+	RunE:  runCurrentContext,
+}
+
+// useContextCmd represents the config use-context command
+var useContextCmd = &cobra.Command{
+	Use:   "use-context NAME",
+	Short: "Set the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runUseContext,
+}
+
+// setContextCmd represents the config set-context command
+var setContextCmd = &cobra.Command{
+	Use:   "set-context NAME",
+	Short: "Create or update a context",
+	Long: `Create a context, or update the fields of an existing one that are given.
+
+Example:
+  mytunnel config set-context prod --bastion prod --tunnels prod-db,prod-cache
+  mytunnel config set-context prod --refresh 30s`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSetContext,
+}
+
+// deleteContextCmd represents the config delete-context command
+var deleteContextCmd = &cobra.Command{
+	Use:   "delete-context NAME",
+	Short: "Delete a context",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDeleteContext,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(getContextsCmd, currentContextCmd, useContextCmd, setContextCmd, deleteContextCmd)
+
+	addOutputFlags(getContextsCmd, &getContextsOutput, &getContextsSelector)
+
+	setContextCmd.Flags().StringSliceVar(&contextTunnels, "tunnels", nil, "tunnel profiles to open when the context is used")
+	setContextCmd.Flags().DurationVar(&contextRefresh, "refresh", 0, "interval between port discovery refreshes (0 uses the default)")
+}
+
+// activeContext returns the context from --context or current-context, or
+// nil when --bastion is given or no context is set
+func activeContext(cfg *config.Config) (*config.Context, error) {
+	if bastionName != "" && contextName == "" {
+		return nil, nil
+	}
+	name := contextName
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	context, ok := cfg.Contexts[name]
+	if !ok {
+		return nil, fmt.Errorf("context '%s' not found", name)
+	}
+	if context.Err != nil {
+		return nil, context.Err
+	}
+	if bastionName != "" && bastionName != context.Bastion {
+		return nil, fmt.Errorf("--bastion %s conflicts with context '%s', which uses bastion '%s'", bastionName, name, context.Bastion)
+	}
+	return context, nil
+}
+
+// contextView is what listings show of a context
+type contextView struct {
+	Name    string   `json:"name"`
+	Current bool     `json:"current"`
+	Bastion string   `json:"bastion"`
+	Tunnels []string `json:"tunnels,omitempty"`
+	Refresh string   `json:"refresh,omitempty"`
+}
+
+func runGetContexts(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(getContextsOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	printWarnings(cfg)
+
+	list := listing{
+		kind:    "context",
+		empty:   "No contexts configured",
+		headers: []string{"CURRENT", "NAME", "BASTION", "TUNNELS", "REFRESH"},
+	}
+	for _, name := range cfg.ContextNames() {
+		context := cfg.Contexts[name]
+		current := ""
+		if name == cfg.CurrentContext {
+			current = "*"
+		}
+		list.items = append(list.items, listItem{
+			name: name,
+			fields: map[string]string{
+				"name":    name,
+				"bastion": context.Bastion,
+				"current": fmt.Sprint(current != ""),
+			},
+			row: []string{
+				current,
+				name,
+				context.Bastion,
+				orDash(strings.Join(context.Tunnels, ",")),
+				orDash(formatDuration(context.Refresh)),
+			},
+			value: contextView{
+				Name:    name,
+				Current: current != "",
+				Bastion: context.Bastion,
+				Tunnels: context.Tunnels,
+				Refresh: formatDuration(context.Refresh),
+			},
+		})
+	}
+
+	return list.print(getContextsOutput, getContextsSelector)
+}
+
+func runCurrentContext(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.CurrentContext == "" {
+		return fmt.Errorf("current-context is not set")
+	}
+	fmt.Println(cfg.CurrentContext)
+	return nil
+}
+
+func runUseContext(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.UseContext(args[0]); err != nil {
+		return err
+	}
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("Switched to context '%s'\n", args[0])
+	return nil
+}
+
+func runSetContext(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	context, exists := cfg.Contexts[name]
+	if !exists {
+		if bastionName == "" {
+			return fmt.Errorf("--bastion is required for a new context")
+		}
+		context = &config.Context{}
+	}
+	if bastionName != "" {
+		context.Bastion = bastionName
+	}
+	if cmd.Flags().Changed("tunnels") {
+		context.Tunnels = contextTunnels
+	}
+	if cmd.Flags().Changed("refresh") {
+		context.Refresh = contextRefresh
+	}
+	if err := cfg.ValidateContext(name, context); err != nil {
+		return err
+	}
+	cfg.AddContext(name, context)
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	if exists {
+		fmt.Printf("Successfully updated context '%s'\n", name)
+	} else {
+		fmt.Printf("Successfully added context '%s'\n", name)
+	}
+	return nil
+}
+
+func runDeleteContext(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if _, ok := cfg.Contexts[name]; !ok {
+		return fmt.Errorf("context '%s' not found", name)
+	}
+	cfg.RemoveContext(name)
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("Successfully deleted context '%s'\n", name)
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/ssh"
+)
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run tunnels in a daemon that outlives the UI",
+	Long: `Run a daemon that owns all tunnels and serves a control API on a Unix socket
+in ~/.mytunnel. While it is running, the UI and the tunnel commands open and
+close tunnels through it, so quitting the UI leaves tunnels up.
+
+Tunnel profiles marked autostart are opened when the daemon starts.
+
+The daemon runs in the foreground until interrupted; start it in the background
+with your shell or a service manager.
+
+Unknown bastion host keys can't be confirmed by the daemon. Open the UI for a
+bastion once to trust its key.
+
+Example:
+  mytunnel daemon &
+  mytunnel daemon stop`,
+	RunE: runDaemon,
+}
+
+// daemonStopCmd represents the daemon stop command
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running daemon and close its tunnels",
+	RunE:  runDaemonStop,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+}
+
+// resolveSocketPath returns the daemon socket from --socket or the default location
+func resolveSocketPath() (string, error) {
+	if socketPath != "" {
+		return socketPath, nil
+	}
+	return daemon.DefaultSocketPath()
+}
+
+// dialDaemon connects to the running daemon
+func dialDaemon() (*daemon.Client, error) {
+	path, err := resolveSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return daemon.Dial(path)
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	path, err := resolveSocketPath()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Without a host key prompt, unknown bastions are rejected
+	tunnelManager := ssh.NewTunnelManager()
+	defer tunnelManager.CloseAll()
+
+	listener, err := daemon.Listen(path)
+	if err != nil {
+		return err
+	}
+
+	local := daemon.NewLocal(tunnelManager, daemon.LoadBastion)
+	go func() {
+		cfg, err := config.LoadConfig()
+		if err == nil {
+			err = daemon.Autostart(ctx, local, cfg)
+		}
+		if err != nil {
+			slog.Error("failed to start autostart tunnels", "error", err)
+		}
+	}()
+
+	server := daemon.NewServer(local, logRing)
+	fmt.Printf("mytunnel daemon listening on %s\n", path)
+	return server.Serve(ctx, listener)
+}
+
+func runDaemonStop(cmd *cobra.Command, args []string) error {
+	client, err := dialDaemon()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop daemon: %w", err)
+	}
+
+	fmt.Println("Daemon stopped")
+	return nil
+}
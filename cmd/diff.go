@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each change
+const diffContext = 3
+
+// writeDiff writes a unified diff of two texts, printing nothing when they are equal
+func writeDiff(w io.Writer, oldName, newName, oldText, newText string) {
+	a, b := diffLines(oldText), diffLines(newText)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table into a list of edits
+	type edit struct {
+		op   byte
+		line string
+		// oldLine and newLine are the 1-based positions before the edit
+		oldLine, newLine int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i + 1, j + 1})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// Removed lines come before the lines that replace them
+			edits = append(edits, edit{'-', a[i], i + 1, j + 1})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i + 1, j + 1})
+			j++
+		}
+	}
+
+	header := false
+	for start := 0; start < len(edits); {
+		// Find the next change and the end of its hunk
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		// Changes with up to 2*diffContext unchanged lines between them share a hunk
+		last := first
+		for k := first; k < len(edits) && k <= last+2*diffContext+1; k++ {
+			if edits[k].op != ' ' {
+				last = k
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(edits))
+
+		if !header {
+			fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+			header = true
+		}
+		oldCount, newCount := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(edits[from].oldLine, oldCount), hunkRange(edits[from].newLine, newCount))
+		for _, e := range edits[from:to] {
+			fmt.Fprintf(w, "%c%s\n", e.op, e.line)
+		}
+		start = to
+	}
+}
+
+// diffLines splits a text into lines, an empty text having none
+func diffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// hunkRange formats the start and length of one side of a hunk. A side with
+// no lines starts at the line before the hunk, as in diff -u.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
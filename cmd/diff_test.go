@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDiff(t *testing.T) {
+	numbered := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n"
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "replaced line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "added to empty",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "removed everything",
+			old:  "a\nb\n",
+			new:  "",
+			want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "1\nX\n3\n4\n5\n6\n7\n8\nY\n10\n",
+			want: "--- old\n+++ new\n@@ -1,10 +1,10 @@\n 1\n-2\n+X\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+Y\n 10\n",
+		},
+		{
+			name: "changes seven lines apart get their own hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			new:  "1\nX\n3\n4\n5\n6\n7\n8\n9\nY\n11\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n" +
+				"@@ -7,5 +7,5 @@\n 7\n 8\n 9\n-10\n+Y\n 11\n",
+		},
+		{
+			name: "distant changes get their own hunks",
+			old:  numbered,
+			new:  strings.Replace(strings.Replace(numbered, "2\n", "", 1), "\n18\n", "\n18\n18.5\n", 1),
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,4 @@\n 1\n-2\n 3\n 4\n 5\n" +
+				"@@ -16,5 +15,6 @@\n 16\n 17\n 18\n+18.5\n 19\n 20\n",
+		},
+		{
+			name: "missing final newline",
+			old:  "a\nb",
+			new:  "a\nc",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			writeDiff(&out, "old", "new", tt.old, tt.new)
+			if got := out.String(); got != tt.want {
+				t.Errorf("writeDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/export"
+)
+
+var exportFormat string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export bastions and tunnels as OpenSSH commands or ssh_config",
+	Long: `Print the plain OpenSSH equivalent of a bastion or of the open tunnels, either
+as an 'ssh -N' command line (--format command) or as Host blocks for
+~/.ssh/config (--format ssh-config). Passwords are never exported; ssh asks
+for them instead.`,
+}
+
+// exportBastionCmd represents the export bastion command
+var exportBastionCmd = &cobra.Command{
+	Use:   "bastion NAME",
+	Short: "Export a bastion and the hops before it",
+	Long: `Export a bastion and the hops before it.
+
+Example:
+  mytunnel export bastion prod
+  mytunnel export bastion prod --format ssh-config >> ~/.ssh/config`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExportBastion,
+}
+
+// exportTunnelsCmd represents the export tunnels command
+var exportTunnelsCmd = &cobra.Command{
+	Use:   "tunnels",
+	Short: "Export the tunnels of the running daemon",
+	Long: `Export the tunnels of the running daemon, one ssh command or Host block per
+bastion. --bastion limits the export to the tunnels of one bastion.
+
+Example:
+  mytunnel export tunnels
+  mytunnel export tunnels --bastion prod --format ssh-config`,
+	Args: cobra.NoArgs,
+	RunE: runExportTunnels,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportBastionCmd, exportTunnelsCmd)
+
+	exportCmd.PersistentFlags().StringVar(&exportFormat, "format", "command", "export format (command or ssh-config)")
+}
+
+func runExportBastion(cmd *cobra.Command, args []string) error {
+	format, err := export.ParseFormat(exportFormat)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	bastion, err := cfg.GetBastion(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(export.Export(format, bastion, nil))
+	return nil
+}
+
+func runExportTunnels(cmd *cobra.Command, args []string) error {
+	format, err := export.ParseFormat(exportFormat)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	client, err := daemonClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelRequestTimeout)
+	defer cancel()
+	tunnels, err := client.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	byBastion := make(map[string][]daemon.TunnelInfo)
+	for _, tunnel := range tunnels {
+		if bastionName == "" || tunnel.Bastion == bastionName {
+			byBastion[tunnel.Bastion] = append(byBastion[tunnel.Bastion], tunnel)
+		}
+	}
+	if len(byBastion) == 0 {
+		return fmt.Errorf("no tunnels open")
+	}
+
+	names := make([]string, 0, len(byBastion))
+	for name := range byBastion {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		bastion, err := cfg.GetBastion(name)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(export.Export(format, bastion, byBastion[name]))
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	osuser "os/user"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+	"mytunnel/internal/sshconfig"
+)
+
+var (
+	sshConfigPath string
+	importDryRun  bool
+	importReplace bool
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import bastions and tunnels from other tools",
+}
+
+// importSSHConfigCmd represents the import ssh-config command
+var importSSHConfigCmd = &cobra.Command{
+	Use:   "ssh-config [HOST...]",
+	Short: "Import bastions and tunnels from ~/.ssh/config",
+	Long: `Import Host entries from an OpenSSH client config as bastions, following
+Include directives and applying wildcard Host blocks the way ssh does.
+HostName, User, Port, IdentityFile, ProxyJump and ServerAliveInterval are
+carried over; hosts without an IdentityFile use the SSH agent. Every
+LocalForward line becomes a tunnel profile named <host>-<port>.
+
+Without arguments every host alias is imported, otherwise only the named
+ones and the jump hosts they need. Entries that already exist are kept
+unless --overwrite is given. Use --dry-run to see the changes as a diff of
+the config file without writing it.
+
+Example:
+  mytunnel import ssh-config --dry-run
+  mytunnel import ssh-config prod staging
+  mytunnel import ssh-config --file ./team_ssh_config --overwrite`,
+	RunE: runImportSSHConfig,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importSSHConfigCmd)
+
+	importSSHConfigCmd.Flags().StringVar(&sshConfigPath, "file", "", "ssh config file to import (default is $HOME/.ssh/config)")
+	importSSHConfigCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "show the changes to the config file without writing them")
+	importSSHConfigCmd.Flags().BoolVar(&importReplace, "overwrite", false, "replace bastions and tunnel profiles that already exist")
+}
+
+// sshImport collects the bastions and tunnel profiles converted from an ssh config
+type sshImport struct {
+	file     *sshconfig.File
+	bastions map[string]*config.BastionConfig
+	tunnels  map[string]*config.TunnelProfile
+	// order is the order bastions were converted in, for reporting
+	order    []string
+	warnings []string
+}
+
+// addHost converts a host and, first, the jump hosts it goes through. The
+// returned name is the bastion's key in the config.
+func (imp *sshImport) addHost(alias string, visiting map[string]bool) (string, error) {
+	if _, ok := imp.bastions[alias]; ok {
+		return alias, nil
+	}
+	if visiting[alias] {
+		return "", fmt.Errorf("host '%s': ProxyJump chain loops back on itself", alias)
+	}
+	visiting[alias] = true
+	defer delete(visiting, alias)
+
+	host, warnings := imp.file.Resolve(alias)
+	imp.warnings = append(imp.warnings, warnings...)
+
+	bastion := &config.BastionConfig{
+		Host:              host.HostName,
+		User:              host.User,
+		Port:              host.Port,
+		AuthType:          "agent",
+		KeepAliveInterval: host.ServerAliveInterval,
+	}
+	if bastion.User == "" {
+		bastion.User = defaultUser()
+	}
+	if bastion.Port == 0 {
+		bastion.Port = 22
+	}
+	if len(host.IdentityFiles) > 0 {
+		bastion.AuthType = "key"
+		bastion.KeyPath = host.IdentityFiles[0]
+		if len(host.IdentityFiles) > 1 {
+			imp.warnings = append(imp.warnings, fmt.Sprintf("host '%s': only the first IdentityFile, %s, is used", alias, bastion.KeyPath))
+		}
+	}
+
+	for _, spec := range host.ProxyJump {
+		jump, err := imp.addJump(spec, visiting)
+		if err != nil {
+			return "", err
+		}
+		bastion.ProxyJump = append(bastion.ProxyJump, jump)
+	}
+
+	imp.bastions[alias] = bastion
+	imp.order = append(imp.order, alias)
+
+	for _, forward := range host.LocalForwards {
+		name := fmt.Sprintf("%s-%d", alias, forward.LocalPort)
+		imp.tunnels[name] = &config.TunnelProfile{
+			Bastion:    alias,
+			LocalPort:  forward.LocalPort,
+			RemoteHost: forward.RemoteHost,
+			RemotePort: forward.RemotePort,
+		}
+	}
+	return alias, nil
+}
+
+// addJump converts a ProxyJump entry of the form [user@]host[:port]. A plain
+// host is resolved through the ssh config like any alias; a user or port in
+// the entry overrides what the config says and keeps the full entry as name.
+func (imp *sshImport) addJump(spec string, visiting map[string]bool) (string, error) {
+	hostPart, userName := spec, ""
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		userName, hostPart = spec[:i], spec[i+1:]
+	}
+	port := 0
+	if i := strings.LastIndex(hostPart, ":"); i >= 0 && !strings.HasSuffix(hostPart, "]") {
+		p, err := strconv.Atoi(hostPart[i+1:])
+		if err != nil || p <= 0 || p > 65535 {
+			return "", fmt.Errorf("invalid ProxyJump entry %q", spec)
+		}
+		hostPart, port = hostPart[:i], p
+	}
+	hostPart = strings.TrimSuffix(strings.TrimPrefix(hostPart, "["), "]")
+
+	name, err := imp.addHost(hostPart, visiting)
+	if err != nil || (userName == "" && port == 0) {
+		return name, err
+	}
+
+	override := *imp.bastions[name]
+	if userName != "" {
+		override.User = userName
+	}
+	if port != 0 {
+		override.Port = port
+	}
+	if _, ok := imp.bastions[spec]; !ok {
+		imp.order = append(imp.order, spec)
+	}
+	imp.bastions[spec] = &override
+	return spec, nil
+}
+
+// defaultUser returns the local user name, which ssh uses when no User is set
+func defaultUser() string {
+	if u, err := osuser.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func runImportSSHConfig(cmd *cobra.Command, args []string) error {
+	path := sshConfigPath
+	if path == "" {
+		var err error
+		if path, err = sshconfig.DefaultPath(); err != nil {
+			return err
+		}
+	}
+	file, err := sshconfig.Load(path)
+	if err != nil {
+		return err
+	}
+
+	aliases := args
+	if len(aliases) == 0 {
+		aliases = file.Aliases()
+	}
+	if len(aliases) == 0 {
+		return fmt.Errorf("no Host entries found in %s", path)
+	}
+
+	imp := &sshImport{
+		file:     file,
+		bastions: make(map[string]*config.BastionConfig),
+		tunnels:  make(map[string]*config.TunnelProfile),
+	}
+	for _, alias := range aliases {
+		if _, err := imp.addHost(alias, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfgPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	before, err := config.Marshal(cfg.Redacted())
+	if err != nil {
+		return err
+	}
+
+	var skipped []string
+	bastions, tunnels := 0, 0
+	for _, name := range imp.order {
+		if _, ok := cfg.Bastions[name]; ok && !importReplace {
+			skipped = append(skipped, "bastion '"+name+"'")
+			continue
+		}
+		cfg.AddBastion(name, imp.bastions[name])
+		bastions++
+	}
+	for _, name := range sortedKeys(imp.tunnels) {
+		if _, ok := cfg.Tunnels[name]; ok && !importReplace {
+			skipped = append(skipped, "tunnel profile '"+name+"'")
+			continue
+		}
+		cfg.AddTunnel(name, imp.tunnels[name])
+		tunnels++
+	}
+
+	// Make sure the result loads again
+	for _, name := range imp.order {
+		if _, err := cfg.ResolveJumps(name); err != nil {
+			return err
+		}
+	}
+	for name := range imp.tunnels {
+		if err := cfg.ValidateTunnel(name, cfg.Tunnels[name]); err != nil {
+			return err
+		}
+	}
+
+	for _, warning := range imp.warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	for _, entry := range skipped {
+		fmt.Fprintf(os.Stderr, "Skipping %s, it already exists (use --overwrite to replace it)\n", entry)
+	}
+
+	if importDryRun {
+		after, err := config.Marshal(cfg.Redacted())
+		if err != nil {
+			return err
+		}
+		if string(before) == string(after) {
+			fmt.Println("No changes")
+			return nil
+		}
+		writeDiff(os.Stdout, cfgPath, cfgPath+" (imported)", string(before), string(after))
+		return nil
+	}
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Printf("Imported %d bastions and %d tunnel profiles from %s\n", bastions, tunnels, path)
+	return nil
+}
+
+// sortedKeys returns the names of the tunnel profiles in alphabetical order
+func sortedKeys(tunnels map[string]*config.TunnelProfile) []string {
+	names := make([]string, 0, len(tunnels))
+	for name := range tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,52 +1,146 @@
-package cmd
-
-import (
-	"fmt"
-	"os"
-	"text/tabwriter"
-
-	"github.com/spf13/cobra"
-	"mytunnel/internal/config"
-)
-
-// listBastionsCmd represents the list-bastions command
-var listBastionsCmd = &cobra.Command{
-	Use:   "list-bastions",
-	Short: "List all configured bastion servers",
-	Long: `List all bastion servers that have been configured in MyTunnel.
-Displays the name, host, user, port, and authentication type for each bastion.`,
-	RunE: runListBastions,
-}
-
-func init() {
-	rootCmd.AddCommand(listBastionsCmd)
-}
-
-func runListBastions(cmd *cobra.Command, args []string) error {
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	if len(cfg.Bastions) == 0 {
-		fmt.Println("No bastion servers configured")
-		return nil
-	}
-
-	// Create tabwriter for formatted output
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "NAME\tHOST\tUSER\tPORT\tAUTH TYPE")
-	fmt.Fprintln(w, "----\t----\t----\t----\t---------")
-
-	for name, bastion := range cfg.Bastions {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
-			name,
-			bastion.Host,
-			bastion.User,
-			bastion.Port,
-			bastion.AuthType)
-	}
-
-	return w.Flush()
-} 
\ No newline at end of file
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+)
+
+// listBastionsCmd represents the list-bastions command
+var listBastionsCmd = &cobra.Command{
+	Use:   "list-bastions",
+	Short: "List all configured bastion servers",
+	Long: `List all bastion servers that have been configured in MyTunnel.
+Displays the name, host, user, port, authentication type, the full
+ProxyJump route and the config files defining each bastion, lowest
+precedence first. Passwords are never shown.
+
+Example:
+  mytunnel list-bastions -o wide
+  mytunnel list-bastions -o json --selector auth_type=agent
+  mytunnel list-bastions -o name --selector 'name=prod-*'`,
+	RunE: runListBastions,
+}
+
+var (
+	listBastionsOutput   string
+	listBastionsSelector string
+)
+
+func init() {
+	rootCmd.AddCommand(listBastionsCmd)
+	addOutputFlags(listBastionsCmd, &listBastionsOutput, &listBastionsSelector)
+}
+
+// bastionView is what listings show of a bastion. It leaves out the password.
+type bastionView struct {
+	Name              string   `json:"name"`
+	Host              string   `json:"host"`
+	User              string   `json:"user"`
+	Port              int      `json:"port"`
+	AuthType          string   `json:"auth_type"`
+	KeyPath           string   `json:"key_path,omitempty"`
+	ProxyJump         []string `json:"proxy_jump,omitempty"`
+	Route             []string `json:"route"`
+	KeepAliveInterval string   `json:"keepalive_interval,omitempty"`
+	IdleTimeout       string   `json:"idle_timeout,omitempty"`
+	MaxLifetime       string   `json:"max_lifetime,omitempty"`
+	Sources           []string `json:"sources,omitempty"`
+}
+
+// shortPath abbreviates a path under the home directory with ~
+func shortPath(p string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	if rel, err := filepath.Rel(home, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Join("~", rel)
+	}
+	return p
+}
+
+// formatDuration renders an optional duration setting, blank when unset
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// orDash replaces a blank table cell with "-"
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func runListBastions(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(listBastionsOutput); err != nil {
+		return err
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	printWarnings(cfg)
+
+	list := listing{
+		kind:        "bastion",
+		empty:       "No bastion servers configured",
+		headers:     []string{"NAME", "HOST", "USER", "PORT", "AUTH TYPE", "ROUTE", "SOURCE"},
+		wideHeaders: []string{"KEY PATH", "KEEPALIVE", "IDLE TIMEOUT", "MAX LIFETIME"},
+	}
+	for _, name := range cfg.BastionNames() {
+		bastion := cfg.Bastions[name]
+		sources := make([]string, len(bastion.Sources))
+		for i, source := range bastion.Sources {
+			sources[i] = shortPath(source)
+		}
+		view := bastionView{
+			Name:              name,
+			Host:              bastion.Host,
+			User:              bastion.User,
+			Port:              bastion.Port,
+			AuthType:          bastion.AuthType,
+			KeyPath:           bastion.KeyPath,
+			ProxyJump:         bastion.ProxyJump,
+			Route:             bastion.Route(),
+			KeepAliveInterval: formatDuration(bastion.KeepAliveInterval),
+			IdleTimeout:       formatDuration(bastion.IdleTimeout),
+			MaxLifetime:       formatDuration(bastion.MaxLifetime),
+			Sources:           bastion.Sources,
+		}
+		list.items = append(list.items, listItem{
+			name: name,
+			fields: map[string]string{
+				"name":      name,
+				"host":      bastion.Host,
+				"user":      bastion.User,
+				"port":      strconv.Itoa(bastion.Port),
+				"auth_type": bastion.AuthType,
+				"jump":      strings.Join(bastion.ProxyJump, ","),
+				"source":    strings.Join(sources, ","),
+			},
+			row: []string{name, bastion.Host, bastion.User, strconv.Itoa(bastion.Port), bastion.AuthType, bastion.RouteString(), orDash(strings.Join(sources, ", "))},
+			wide: []string{
+				orDash(bastion.KeyPath),
+				orDash(view.KeepAliveInterval),
+				orDash(view.IdleTimeout),
+				orDash(view.MaxLifetime),
+			},
+			value: view,
+		})
+	}
+
+	return list.print(listBastionsOutput, listBastionsSelector)
+}
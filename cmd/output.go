@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"mytunnel/internal/config"
+)
+
+// outputFormats are the values accepted by -o
+var outputFormats = []string{"table", "wide", "json", "yaml", "name"}
+
+// listing is what a listing command prints, in any output format
+type listing struct {
+	// kind prefixes names in -o name output, such as bastion/prod
+	kind string
+	// empty is printed instead of an empty table
+	empty   string
+	headers []string
+	// wideHeaders are the extra columns shown by -o wide
+	wideHeaders []string
+	items       []listItem
+}
+
+// listItem is one row of a listing
+type listItem struct {
+	name string
+	// fields are the values --selector can match on
+	fields map[string]string
+	row    []string
+	wide   []string
+	// value is encoded by -o json and -o yaml. It must never hold secrets.
+	value any
+}
+
+// printWarnings reports problems found in the config file on stderr, so they
+// don't end up in output meant for other programs
+func printWarnings(cfg *config.Config) {
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
+
+// addOutputFlags adds -o and --selector to a listing command
+func addOutputFlags(cmd *cobra.Command, output, selector *string) {
+	cmd.Flags().StringVarP(output, "output", "o", "table", "output format ("+strings.Join(outputFormats, ", ")+")")
+	cmd.Flags().StringVarP(selector, "selector", "l", "", "only list items matching field=value or field!=value, comma separated; values may use * wildcards")
+}
+
+// checkOutputFormat validates -o before any work is done
+func checkOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q: must be one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// print filters the listing with selector and writes it in the given format
+func (l *listing) print(format, selector string) error {
+	if err := checkOutputFormat(format); err != nil {
+		return err
+	}
+	requirements, err := parseSelector(selector)
+	if err != nil {
+		return err
+	}
+
+	var items []listItem
+	for _, item := range l.items {
+		matched, err := requirements.matches(item.fields)
+		if err != nil {
+			return err
+		}
+		if matched {
+			items = append(items, item)
+		}
+	}
+
+	switch format {
+	case "json", "yaml":
+		values := make([]any, 0, len(items))
+		for _, item := range items {
+			values = append(values, item.value)
+		}
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		if format == "yaml" {
+			if data, err = jsonToYAML(data); err != nil {
+				return fmt.Errorf("failed to encode output: %w", err)
+			}
+		}
+		_, err = fmt.Fprintln(os.Stdout, strings.TrimSuffix(string(data), "\n"))
+		return err
+	case "name":
+		for _, item := range items {
+			fmt.Printf("%s/%s\n", l.kind, item.name)
+		}
+		return nil
+	}
+
+	if len(items) == 0 {
+		if selector != "" {
+			fmt.Printf("No %ss match %q\n", l.kind, selector)
+		} else {
+			fmt.Println(l.empty)
+		}
+		return nil
+	}
+
+	headers := l.headers
+	if format == "wide" {
+		headers = append(append([]string{}, headers...), l.wideHeaders...)
+	}
+	underline := make([]string, len(headers))
+	for i, header := range headers {
+		underline[i] = strings.Repeat("-", len(header))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	fmt.Fprintln(w, strings.Join(underline, "\t"))
+	for _, item := range items {
+		row := item.row
+		if format == "wide" {
+			row = append(append([]string{}, row...), item.wide...)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// jsonToYAML re-encodes JSON as block-style YAML, keeping the field order
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	var unstyle func(n *yaml.Node)
+	unstyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			unstyle(child)
+		}
+	}
+	unstyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// requirement is a single field=value or field!=value term of a selector
+type requirement struct {
+	field  string
+	value  string
+	negate bool
+}
+
+// selector is a parsed --selector; every requirement must match
+type selector []requirement
+
+// parseSelector parses a comma separated list of field=value, field==value
+// and field!=value terms
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var r requirement
+		var ok bool
+		if r.field, r.value, ok = strings.Cut(term, "!="); ok {
+			r.negate = true
+		} else if r.field, r.value, ok = strings.Cut(term, "=="); !ok {
+			r.field, r.value, ok = strings.Cut(term, "=")
+		}
+		r.field, r.value = strings.TrimSpace(r.field), strings.TrimSpace(r.value)
+		if !ok || r.field == "" {
+			return nil, fmt.Errorf("invalid selector %q: expected field=value or field!=value", term)
+		}
+		if _, err := path.Match(r.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", term, err)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// matches reports whether fields satisfy every requirement
+func (s selector) matches(fields map[string]string) (bool, error) {
+	for _, r := range s {
+		value, ok := fields[r.field]
+		if !ok {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return false, fmt.Errorf("unknown selector field %q: must be one of %s", r.field, strings.Join(names, ", "))
+		}
+		// The pattern was validated by parseSelector
+		matched, _ := path.Match(r.value, value)
+		if matched == r.negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
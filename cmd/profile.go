@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+)
+
+var (
+	profileLabel     string
+	profileAutostart bool
+	profileFrom      string
+
+	profileListOutput   string
+	profileListSelector string
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage saved tunnel profiles",
+	Long: `Manage tunnel profiles saved under 'tunnels:' in the config file. A profile
+remembers a tunnel's bastion and ports so it can be reopened by name with
+'mytunnel tunnel open --profile NAME'. Profiles marked autostart are opened
+whenever the UI or the daemon starts.`,
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved tunnel profiles",
+	Args:  cobra.NoArgs,
+	RunE:  runProfileList,
+}
+
+// profileSaveCmd represents the profile save command
+var profileSaveCmd = &cobra.Command{
+	Use:   "save NAME",
+	Short: "Save a tunnel profile",
+	Long: `Save a tunnel profile, replacing any profile with the same name. The tunnel is
+described with the same flags as 'mytunnel tunnel open', or copied from a
+tunnel of the running daemon with --from.
+
+Example:
+  mytunnel profile save prod-db --bastion prod --local 15432 --remote db.internal:5432 --autostart
+  mytunnel profile save proxy --from D:1080 --label "SOCKS proxy"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runProfileSave,
+}
+
+// profileDeleteCmd represents the profile delete command
+var profileDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a saved tunnel profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runProfileDelete,
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd, profileSaveCmd, profileDeleteCmd)
+
+	addOutputFlags(profileListCmd, &profileListOutput, &profileListSelector)
+
+	profileSaveCmd.Flags().StringVar(&tunnelType, "type", "local", "tunnel type (local, remote or dynamic)")
+	profileSaveCmd.Flags().IntVar(&tunnelLocalPort, "local", 0, "local port")
+	profileSaveCmd.Flags().StringVar(&tunnelRemote, "remote", "", "target host:port for local tunnels, bastion port for remote tunnels")
+	profileSaveCmd.Flags().StringVar(&profileFrom, "from", "", "copy the tunnel with this ID from the running daemon")
+	profileSaveCmd.Flags().StringVar(&profileLabel, "label", "", "description shown next to the profile")
+	profileSaveCmd.Flags().BoolVar(&profileAutostart, "autostart", false, "open the tunnel whenever mytunnel or its daemon starts")
+}
+
+// profileView is what listings show of a tunnel profile
+type profileView struct {
+	Name       string `json:"name"`
+	Bastion    string `json:"bastion"`
+	Type       string `json:"type"`
+	LocalPort  int    `json:"local_port"`
+	RemoteHost string `json:"remote_host,omitempty"`
+	RemotePort int    `json:"remote_port,omitempty"`
+	Label      string `json:"label,omitempty"`
+	Autostart  bool   `json:"autostart"`
+}
+
+func runProfileList(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(profileListOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	printWarnings(cfg)
+
+	list := listing{
+		kind:    "profile",
+		empty:   "No tunnel profiles saved",
+		headers: []string{"NAME", "BASTION", "TYPE", "FORWARDING", "AUTOSTART", "LABEL"},
+	}
+	for _, name := range cfg.TunnelNames() {
+		profile := cfg.Tunnels[name]
+		req, err := daemon.ProfileRequest(profile)
+		if err != nil {
+			// Already reported by printWarnings
+			continue
+		}
+		list.items = append(list.items, listItem{
+			name: name,
+			fields: map[string]string{
+				"name":      name,
+				"bastion":   profile.Bastion,
+				"type":      req.Type.String(),
+				"autostart": strconv.FormatBool(profile.Autostart),
+			},
+			row: []string{
+				name,
+				profile.Bastion,
+				req.Type.String(),
+				describeTunnel(daemon.TunnelInfo{
+					Type:       req.Type,
+					LocalPort:  req.LocalPort,
+					RemoteHost: req.RemoteHost,
+					RemotePort: req.RemotePort,
+				}),
+				strconv.FormatBool(profile.Autostart),
+				orDash(profile.Label),
+			},
+			value: profileView{
+				Name:       name,
+				Bastion:    profile.Bastion,
+				Type:       req.Type.String(),
+				LocalPort:  profile.LocalPort,
+				RemoteHost: profile.RemoteHost,
+				RemotePort: profile.RemotePort,
+				Label:      profile.Label,
+				Autostart:  profile.Autostart,
+			},
+		})
+	}
+
+	return list.print(profileListOutput, profileListSelector)
+}
+
+// profileToSave describes the profile from --from or the tunnel flags
+func profileToSave(cmd *cobra.Command) (*config.TunnelProfile, error) {
+	if profileFrom == "" {
+		req, err := openRequest(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return daemon.NewProfile(daemon.TunnelInfo{
+			Type:       req.Type,
+			Bastion:    req.Bastion,
+			LocalPort:  req.LocalPort,
+			RemoteHost: req.RemoteHost,
+			RemotePort: req.RemotePort,
+		}), nil
+	}
+
+	// The daemon's tunnel already has its bastion and ports
+	for _, flag := range []string{"bastion", "context", "type", "local", "remote"} {
+		if cmd.Flags().Changed(flag) {
+			return nil, fmt.Errorf("--%s can't be combined with --from", flag)
+		}
+	}
+
+	client, err := daemonClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelRequestTimeout)
+	defer cancel()
+	tunnels, err := client.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnels: %w", err)
+	}
+	for _, tunnel := range tunnels {
+		if tunnel.ID == profileFrom {
+			return daemon.NewProfile(tunnel), nil
+		}
+	}
+	return nil, fmt.Errorf("no tunnel with ID %s", profileFrom)
+}
+
+func runProfileSave(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	profile, err := profileToSave(cmd)
+	if err != nil {
+		return err
+	}
+	profile.Label = profileLabel
+	profile.Autostart = profileAutostart
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ValidateTunnel(name, profile); err != nil {
+		return err
+	}
+	cfg.AddTunnel(name, profile)
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("Successfully saved tunnel profile '%s'\n", name)
+	return nil
+}
+
+func runProfileDelete(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if _, ok := cfg.Tunnels[name]; !ok {
+		return fmt.Errorf("tunnel profile '%s' not found", name)
+	}
+	for _, contextName := range cfg.ContextNames() {
+		for _, tunnel := range cfg.Contexts[contextName].Tunnels {
+			if tunnel == name {
+				return fmt.Errorf("tunnel profile '%s' is used by context '%s'", name, contextName)
+			}
+		}
+	}
+	cfg.RemoveTunnel(name)
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("Successfully deleted tunnel profile '%s'\n", name)
+	return nil
+}
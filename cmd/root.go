@@ -1,100 +1,177 @@
-package cmd
-
-import (
-	"fmt"
-	"os"
-	"path/filepath"
-
-	"github.com/spf13/cobra"
-	"mytunnel/internal/config"
-	"mytunnel/internal/ssh"
-	"mytunnel/internal/ui"
-)
-
-var (
-	cfgFile     string
-	bastionName string
-)
-
-// rootCmd represents the base command when called without any subcommands
-var rootCmd = &cobra.Command{
-	Use:   "mytunnel",
-	Short: "A k9s-like SSH tunnel manager",
-	Long: `MyTunnel is an interactive SSH tunnel manager that helps you create and manage
-SSH tunnels through bastion servers with a k9s-like interface.
-
-Features:
-- Interactive terminal UI with Vim-style navigation
-- Bastion server configuration management
-- Real-time port monitoring and tunnel management
-- SSH key and password authentication support`,
-	RunE: runRoot,
-}
-
-// Execute adds all child commands to the root command and sets flags appropriately.
-func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-}
-
-func init() {
-	cobra.OnInitialize(initConfig)
-
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.mytunnel/config.yaml)")
-	rootCmd.PersistentFlags().StringVar(&bastionName, "bastion", "", "bastion server to connect to")
-}
-
-// initConfig reads in config file and ENV variables if set
-func initConfig() {
-	if cfgFile == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		cfgFile = filepath.Join(home, ".mytunnel", "config.yaml")
-	}
-}
-
-func runRoot(cmd *cobra.Command, args []string) error {
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	// If no bastion is specified and there's only one, use it
-	if bastionName == "" {
-		if len(cfg.Bastions) == 0 {
-			return fmt.Errorf("no bastions configured. Use 'mytunnel add-bastion' to add one")
-		}
-		if len(cfg.Bastions) == 1 {
-			for name := range cfg.Bastions {
-				bastionName = name
-				break
-			}
-		} else {
-			return fmt.Errorf("multiple bastions configured, please specify one with --bastion")
-		}
-	}
-
-	// Get the specified bastion
-	bastion, ok := cfg.Bastions[bastionName]
-	if !ok {
-		return fmt.Errorf("bastion '%s' not found", bastionName)
-	}
-
-	// Create tunnel manager
-	tunnelManager := ssh.NewTunnelManager()
-
-	// Create and run UI
-	ui := ui.NewUI(tunnelManager, bastion)
-	
-	// Set some default ports for testing (you would replace this with actual port discovery)
-	ui.SetPorts([]int{22, 80, 443, 3306, 5432, 6379, 8080, 8443})
-
-	return ui.Run()
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/logging"
+	"mytunnel/internal/ssh"
+	"mytunnel/internal/ui"
+)
+
+var (
+	cfgFile         string
+	bastionName     string
+	refreshInterval time.Duration
+	logLevel        string
+	logRing         *logging.Ring
+	socketPath      string
+	contextName     string
+	noDaemon        bool
+)
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "mytunnel",
+	Short: "A k9s-like SSH tunnel manager",
+	Long: `MyTunnel is an interactive SSH tunnel manager that helps you create and manage
+SSH tunnels through bastion servers with a k9s-like interface.
+
+Features:
+- Interactive terminal UI with Vim-style navigation
+- Bastion server configuration management
+- Real-time port monitoring and tunnel management
+- SSH key, password and ssh-agent authentication support`,
+	PersistentPreRunE: setupLogging,
+	RunE:              runRoot,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	cobra.OnInitialize(initConfig)
+
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $"+config.EnvPath+", $XDG_CONFIG_HOME/mytunnel/config.yaml if it exists, or $HOME/.mytunnel/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&bastionName, "bastion", "", "bastion server to connect to")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "context to use instead of the current context")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level (debug, info, warn or error), logs are written to $HOME/.mytunnel/logs")
+	rootCmd.PersistentFlags().StringVar(&socketPath, "socket", "", "daemon control socket (default is $HOME/.mytunnel/mytunnel.sock)")
+	rootCmd.Flags().DurationVar(&refreshInterval, "refresh", 5*time.Second, "interval between port discovery refreshes")
+	rootCmd.PersistentFlags().BoolVar(&noDaemon, "no-daemon", false, "run tunnels in this process even if a daemon is running")
+}
+
+// initConfig points the config package at the --config file, if given
+func initConfig() {
+	config.SetPath(cfgFile)
+}
+
+// setupLogging sends log output to the log file instead of the terminal
+func setupLogging(cmd *cobra.Command, args []string) error {
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	// The daemon keeps its own log file so it never rotates the UI's
+	name := "mytunnel"
+	if cmd == daemonCmd {
+		name = "daemon"
+	}
+	logRing, err = logging.Setup(name, level)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	return nil
+}
+
+func runRoot(cmd *cobra.Command, args []string) error {
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use --bastion, the current context, or the only bastion configured
+	name, err := defaultBastion(cfg)
+	if err != nil {
+		return err
+	}
+	bastion, err := cfg.GetBastion(name)
+	if err != nil {
+		return err
+	}
+	context, err := activeContext(cfg)
+	if err != nil {
+		return err
+	}
+
+	if refreshInterval <= 0 {
+		return fmt.Errorf("refresh interval must be positive")
+	}
+	// A context's refresh interval applies unless --refresh is given
+	interval := func(context *config.Context) time.Duration {
+		if context != nil && context.Refresh > 0 && !cmd.Flags().Changed("refresh") {
+			return context.Refresh
+		}
+		return refreshInterval
+	}
+
+	// Create tunnel manager. Port discovery always runs in this process so
+	// that unknown host keys can be confirmed in the UI.
+	tunnelManager := ssh.NewTunnelManager()
+
+	// Hand tunnels to the daemon when one is running so they outlive the UI
+	var tunnels daemon.Controller = daemon.NewLocal(tunnelManager, daemon.LoadBastion)
+	var logs logging.Source = logRing
+	status := "Press '?' for help"
+	if !noDaemon {
+		if client, err := dialDaemon(); err == nil {
+			tunnels = client
+			logs = logging.Merge(logRing, client)
+			status = "Attached to the daemon, tunnels stay open after quitting. Press '?' for help"
+		}
+	}
+
+	// Create and run UI
+	ui := ui.NewUI(tunnels, bastion)
+	ui.SetLogs(logs)
+	ui.SetStatus(status)
+	tunnelManager.SetHostKeyPrompt(ui.ConfirmHostKey)
+	if context != nil {
+		ui.SetContext(context)
+	}
+	ui.Autostart(cfg, context)
+
+	// Discover listening ports on the bastion in the background, starting
+	// over whenever the user switches to another context
+	var mu sync.Mutex
+	var discovery *ssh.PortDiscovery
+	watch := func(bastion *config.BastionConfig, context *config.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		if discovery != nil {
+			discovery.Stop()
+		}
+		current := ssh.NewPortDiscovery(tunnelManager, bastion, interval(context))
+		discovery = current
+		current.Start(func(ports []ssh.ListeningPort, err error) {
+			// Drop the last result of a discovery that was replaced
+			mu.Lock()
+			stale := discovery != current
+			mu.Unlock()
+			if !stale {
+				ui.UpdatePorts(ports, err)
+			}
+		})
+	}
+	watch(bastion, context)
+	ui.SetSwitchHandler(watch)
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		discovery.Stop()
+	}()
+
+	return ui.Run()
 } 
\ No newline at end of file
@@ -0,0 +1,444 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/ssh"
+)
+
+// tunnelRequestTimeout bounds list and close requests
+const tunnelRequestTimeout = 10 * time.Second
+
+var (
+	tunnelType        string
+	tunnelLocalPort   int
+	tunnelRemote      string
+	tunnelProfile     string
+	tunnelIdleTimeout time.Duration
+	tunnelMaxLifetime time.Duration
+	closeAll          bool
+
+	tunnelListOutput   string
+	tunnelListSelector string
+)
+
+// tunnelCmd represents the tunnel command
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Open, list and close tunnels without the UI",
+}
+
+// tunnelOpenCmd represents the tunnel open command
+var tunnelOpenCmd = &cobra.Command{
+	Use:   "open",
+	Short: "Open a tunnel through a bastion",
+	Long: `Open a tunnel through a bastion server.
+
+When a daemon is running the tunnel is handed to it and the command returns
+right away, printing the tunnel ID. Otherwise the tunnel runs in the
+foreground until interrupted with Ctrl+C or closed by its idle timeout or
+max lifetime.
+
+--remote is the host:port to reach from the bastion for local tunnels and the
+bastion port to listen on for remote tunnels, where 0 lets the bastion pick
+one. Dynamic tunnels (SOCKS proxies) only need --local. --profile opens a
+tunnel saved with 'mytunnel profile save' instead.
+
+Example:
+  mytunnel tunnel open --bastion prod --local 15432 --remote db.internal:5432
+  mytunnel tunnel open --bastion prod --type dynamic --local 1080
+  mytunnel tunnel open --bastion prod --type remote --local 3000 --remote 8080
+  mytunnel tunnel open --profile prod-db`,
+	RunE: runTunnelOpen,
+}
+
+// tunnelListCmd represents the tunnel list command
+var tunnelListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the tunnels of the running daemon",
+	Args:  cobra.NoArgs,
+	RunE:  runTunnelList,
+}
+
+// tunnelCloseCmd represents the tunnel close command
+var tunnelCloseCmd = &cobra.Command{
+	Use:   "close [ID...]",
+	Short: "Close tunnels of the running daemon by ID",
+	Long: `Close tunnels of the running daemon. IDs are shown by 'mytunnel tunnel list',
+such as L:15432 for a local tunnel, D:1080 for a SOCKS proxy and R:8080 for a
+remote tunnel.
+
+Example:
+  mytunnel tunnel close L:15432
+  mytunnel tunnel close --all`,
+	RunE: runTunnelClose,
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+	tunnelCmd.AddCommand(tunnelOpenCmd, tunnelListCmd, tunnelCloseCmd)
+
+	tunnelOpenCmd.Flags().StringVar(&tunnelType, "type", "local", "tunnel type (local, remote or dynamic)")
+	tunnelOpenCmd.Flags().IntVar(&tunnelLocalPort, "local", 0, "local port")
+	tunnelOpenCmd.Flags().StringVar(&tunnelRemote, "remote", "", "target host:port for local tunnels, bastion port for remote tunnels")
+	tunnelOpenCmd.Flags().DurationVar(&tunnelIdleTimeout, "idle-timeout", 0, "close the tunnel after this long without connections (default from the bastion, 0 disables)")
+	tunnelOpenCmd.Flags().DurationVar(&tunnelMaxLifetime, "max-lifetime", 0, "close the tunnel this long after it is opened (default from the bastion, 0 disables)")
+	tunnelOpenCmd.Flags().StringVar(&tunnelProfile, "profile", "", "open a saved tunnel profile instead of describing the tunnel with flags")
+
+	addOutputFlags(tunnelListCmd, &tunnelListOutput, &tunnelListSelector)
+
+	tunnelCloseCmd.Flags().BoolVar(&closeAll, "all", false, "close every tunnel")
+}
+
+// defaultBastion returns the bastion from --bastion, the active context, or
+// the only configured one
+func defaultBastion(cfg *config.Config) (string, error) {
+	context, err := activeContext(cfg)
+	if err != nil {
+		return "", err
+	}
+	if context != nil {
+		return context.Bastion, nil
+	}
+
+	if bastionName != "" {
+		if _, err := cfg.GetBastion(bastionName); err != nil {
+			return "", err
+		}
+		return bastionName, nil
+	}
+
+	switch len(cfg.Bastions) {
+	case 0:
+		return "", fmt.Errorf("no bastions configured. Use 'mytunnel add-bastion' to add one")
+	case 1:
+		for name := range cfg.Bastions {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("multiple bastions configured, please specify one with --bastion or set a context with 'mytunnel config use-context'")
+}
+
+// openRequest builds the tunnel to open from the command line flags
+func openRequest(cmd *cobra.Command) (daemon.OpenRequest, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return daemon.OpenRequest{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var req daemon.OpenRequest
+	if tunnelProfile != "" {
+		req, err = profileRequest(cmd, cfg)
+	} else {
+		req, err = flagRequest(cfg)
+	}
+	if err != nil {
+		return req, err
+	}
+
+	// Only override the bastion's limits when asked to
+	idleSet, lifetimeSet := cmd.Flags().Changed("idle-timeout"), cmd.Flags().Changed("max-lifetime")
+	if tunnelIdleTimeout < 0 || tunnelMaxLifetime < 0 {
+		return req, fmt.Errorf("idle-timeout and max-lifetime must not be negative")
+	}
+	if idleSet || lifetimeSet {
+		bastion, err := cfg.GetBastion(req.Bastion)
+		if err != nil {
+			return req, err
+		}
+		limits := ssh.TunnelLimits{IdleTimeout: bastion.IdleTimeout, MaxLifetime: bastion.MaxLifetime}
+		if idleSet {
+			limits.IdleTimeout = tunnelIdleTimeout
+		}
+		if lifetimeSet {
+			limits.MaxLifetime = tunnelMaxLifetime
+		}
+		req.Limits = &limits
+	}
+	return req, nil
+}
+
+// profileRequest opens the saved profile named by --profile
+func profileRequest(cmd *cobra.Command, cfg *config.Config) (daemon.OpenRequest, error) {
+	for _, flag := range []string{"bastion", "type", "local", "remote"} {
+		if cmd.Flags().Changed(flag) {
+			return daemon.OpenRequest{}, fmt.Errorf("--%s can't be combined with --profile", flag)
+		}
+	}
+	profile, ok := cfg.Tunnels[tunnelProfile]
+	if !ok {
+		return daemon.OpenRequest{}, fmt.Errorf("tunnel profile '%s' not found", tunnelProfile)
+	}
+	return daemon.ProfileRequest(profile)
+}
+
+// flagRequest builds the tunnel described by --type, --local and --remote
+func flagRequest(cfg *config.Config) (daemon.OpenRequest, error) {
+	name, err := defaultBastion(cfg)
+	if err != nil {
+		return daemon.OpenRequest{}, err
+	}
+
+	typ, err := ssh.ParseTunnelType(tunnelType)
+	if err != nil {
+		return daemon.OpenRequest{}, err
+	}
+	if tunnelLocalPort == 0 {
+		return daemon.OpenRequest{}, fmt.Errorf("--local is required")
+	}
+	if tunnelLocalPort < 0 || tunnelLocalPort > 65535 {
+		return daemon.OpenRequest{}, fmt.Errorf("invalid local port %d", tunnelLocalPort)
+	}
+	req := daemon.OpenRequest{Type: typ, Bastion: name, LocalPort: tunnelLocalPort}
+
+	switch typ {
+	case ssh.LocalTunnel:
+		if tunnelRemote == "" {
+			return req, fmt.Errorf("--remote host:port is required for local tunnels")
+		}
+		req.RemoteHost, req.RemotePort, err = ssh.ParseHostPort(tunnelRemote)
+		if err != nil {
+			return req, err
+		}
+	case ssh.RemoteTunnel:
+		req.RemotePort, err = strconv.Atoi(strings.TrimPrefix(tunnelRemote, ":"))
+		if tunnelRemote == "" || err != nil || req.RemotePort < 0 || req.RemotePort > 65535 {
+			return req, fmt.Errorf("--remote must be the bastion port for remote tunnels, or 0 to let the bastion pick one")
+		}
+	case ssh.DynamicTunnel:
+		if tunnelRemote != "" {
+			return req, fmt.Errorf("--remote is not used by dynamic tunnels")
+		}
+	}
+	return req, nil
+}
+
+// describeTunnel renders where a tunnel forwards to
+func describeTunnel(tunnel daemon.TunnelInfo) string {
+	switch tunnel.Type {
+	case ssh.RemoteTunnel:
+		return fmt.Sprintf("bastion port %d -> localhost:%d", tunnel.RemotePort, tunnel.LocalPort)
+	case ssh.DynamicTunnel:
+		return fmt.Sprintf("SOCKS proxy on localhost:%d", tunnel.LocalPort)
+	default:
+		host := tunnel.RemoteHost
+		if host == "" {
+			host = "localhost"
+		}
+		return fmt.Sprintf("localhost:%d -> %s", tunnel.LocalPort, net.JoinHostPort(host, strconv.Itoa(tunnel.RemotePort)))
+	}
+}
+
+func runTunnelOpen(cmd *cobra.Command, args []string) error {
+	req, err := openRequest(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !noDaemon {
+		client, err := dialDaemon()
+		if err == nil {
+			tunnel, err := client.Open(ctx, req)
+			if err != nil {
+				return fmt.Errorf("failed to open tunnel: %w", err)
+			}
+			fmt.Printf("%s\t%s via %s\n", tunnel.ID, describeTunnel(tunnel), tunnel.Bastion)
+			return nil
+		}
+		if !errors.Is(err, daemon.ErrNotRunning) {
+			return err
+		}
+	}
+
+	return runForeground(ctx, req)
+}
+
+// runForeground runs a tunnel in this process until ctx is cancelled or the
+// tunnel is closed by its limits
+func runForeground(ctx context.Context, req daemon.OpenRequest) error {
+	tunnelManager := ssh.NewTunnelManager()
+	tunnelManager.SetHostKeyPrompt(promptHostKey)
+	defer tunnelManager.CloseAll()
+
+	local := daemon.NewLocal(tunnelManager, daemon.LoadBastion)
+	events, err := local.Events(ctx)
+	if err != nil {
+		return err
+	}
+
+	tunnel, err := local.Open(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to open tunnel: %w", err)
+	}
+	fmt.Printf("Forwarding %s via %s, press Ctrl+C to close\n", describeTunnel(tunnel), tunnel.Bastion)
+
+	reconnecting := false
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "Closing tunnel")
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if event.Tunnel != tunnel.ID {
+				continue
+			}
+			switch event.Type {
+			case ssh.EventReconnecting:
+				reconnecting = true
+				fmt.Fprintf(os.Stderr, "Connection to %s lost, reconnecting (attempt %d)\n", tunnel.Bastion, event.Attempt)
+			case ssh.EventConnected:
+				if reconnecting {
+					reconnecting = false
+					fmt.Fprintf(os.Stderr, "Reconnected to %s\n", tunnel.Bastion)
+				}
+			case ssh.EventError:
+				fmt.Fprintf(os.Stderr, "%s: %s\n", event.Message, event.Error)
+			case ssh.EventExpired:
+				fmt.Fprintf(os.Stderr, "Tunnel expired: %s\n", event.Message)
+			case ssh.EventClosed:
+				return nil
+			}
+		}
+	}
+}
+
+// promptHostKey asks on the terminal whether to trust an unknown host key.
+// Anything but yes, including no terminal at all, rejects the key.
+func promptHostKey(hostname, keyType, fingerprint string) bool {
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n", hostname)
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", keyType, fingerprint)
+	fmt.Fprint(os.Stderr, "Trust this host? [y/N] ")
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// daemonClient connects to the running daemon, explaining that tunnels opened
+// in the foreground can only be managed by their own process
+func daemonClient() (*daemon.Client, error) {
+	client, err := dialDaemon()
+	if errors.Is(err, daemon.ErrNotRunning) {
+		return nil, fmt.Errorf("%w; foreground tunnels are closed with Ctrl+C in their own terminal", err)
+	}
+	return client, err
+}
+
+func runTunnelList(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(tunnelListOutput); err != nil {
+		return err
+	}
+
+	client, err := daemonClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelRequestTimeout)
+	defer cancel()
+	tunnels, err := client.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	list := listing{
+		kind:        "tunnel",
+		empty:       "No tunnels open",
+		headers:     []string{"ID", "TYPE", "BASTION", "FORWARDING", "STATE", "CONNS"},
+		wideHeaders: []string{"BYTES IN", "BYTES OUT", "TOTAL CONNS", "EXPIRES", "LAST ERROR"},
+	}
+	for _, tunnel := range tunnels {
+		expires := "-"
+		if !tunnel.ExpiresAt.IsZero() {
+			expires = fmt.Sprintf("in %s (%s)", time.Until(tunnel.ExpiresAt).Round(time.Second), tunnel.ExpiryReason)
+		}
+		list.items = append(list.items, listItem{
+			name: tunnel.ID,
+			fields: map[string]string{
+				"id":          tunnel.ID,
+				"type":        tunnel.Type.String(),
+				"bastion":     tunnel.Bastion,
+				"state":       tunnel.State.String(),
+				"local_port":  strconv.Itoa(tunnel.LocalPort),
+				"remote_host": tunnel.RemoteHost,
+				"remote_port": strconv.Itoa(tunnel.RemotePort),
+			},
+			row: []string{
+				tunnel.ID,
+				tunnel.Type.String(),
+				tunnel.Bastion,
+				describeTunnel(tunnel),
+				tunnel.State.String(),
+				strconv.FormatInt(tunnel.Stats.ActiveConns, 10),
+			},
+			wide: []string{
+				strconv.FormatInt(tunnel.Stats.BytesIn, 10),
+				strconv.FormatInt(tunnel.Stats.BytesOut, 10),
+				strconv.FormatInt(tunnel.Stats.TotalConns, 10),
+				expires,
+				orDash(tunnel.LastError),
+			},
+			value: tunnel,
+		})
+	}
+	return list.print(tunnelListOutput, tunnelListSelector)
+}
+
+func runTunnelClose(cmd *cobra.Command, args []string) error {
+	if closeAll == (len(args) > 0) {
+		return fmt.Errorf("specify tunnel IDs or --all")
+	}
+
+	client, err := daemonClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelRequestTimeout)
+	defer cancel()
+
+	ids := args
+	if closeAll {
+		tunnels, err := client.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list tunnels: %w", err)
+		}
+		for _, tunnel := range tunnels {
+			ids = append(ids, tunnel.ID)
+		}
+	}
+
+	var failed error
+	for _, id := range ids {
+		if err := client.Close(ctx, id); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close %s: %v\n", id, err)
+			failed = fmt.Errorf("failed to close some tunnels")
+			continue
+		}
+		fmt.Printf("Closed %s\n", id)
+	}
+	return failed
+}
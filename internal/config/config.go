@@ -1,93 +1,338 @@
-package config
-
-import (
-	"fmt"
-	"os"
-	"path/filepath"
-
-	"gopkg.in/yaml.v3"
-)
-
-// Config represents the main configuration structure
-type Config struct {
-	Bastions map[string]*BastionConfig `yaml:"bastions"`
-}
-
-// BastionConfig holds the configuration for a single bastion server
-type BastionConfig struct {
-	Host     string `yaml:"host"`
-	User     string `yaml:"user"`
-	Port     int    `yaml:"port"`
-	AuthType string `yaml:"auth_type"` // "key" or "password"
-	KeyPath  string `yaml:"key_path,omitempty"`
-	Password string `yaml:"password,omitempty"`
-}
-
-// LoadConfig loads the configuration from the default location
-func LoadConfig() (*Config, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
-	}
-
-	configPath := filepath.Join(home, ".mytunnel", "config.yaml")
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Return empty config if file doesn't exist
-			return &Config{Bastions: make(map[string]*BastionConfig)}, nil
-		}
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
-	}
-
-	return &config, nil
-}
-
-// SaveConfig saves the configuration to the default location
-func SaveConfig(config *Config) error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get user home directory: %w", err)
-	}
-
-	configDir := filepath.Join(home, ".mytunnel")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
-
-	configPath := filepath.Join(configDir, "config.yaml")
-	data, err := yaml.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
-
-	if err := os.WriteFile(configPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
-	}
-
-	return nil
-}
-
-// AddBastion adds a new bastion configuration
-func (c *Config) AddBastion(name string, bastion *BastionConfig) {
-	if c.Bastions == nil {
-		c.Bastions = make(map[string]*BastionConfig)
-	}
-	c.Bastions[name] = bastion
-}
-
-// RemoveBastion removes a bastion configuration
-func (c *Config) RemoveBastion(name string) {
-	delete(c.Bastions, name)
-}
-
-// GetBastion retrieves a bastion configuration by name
-func (c *Config) GetBastion(name string) (*BastionConfig, bool) {
-	bastion, ok := c.Bastions[name]
-	return bastion, ok
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPath is the environment variable that points to the config file when
+// no path is set explicitly
+const EnvPath = "MYTUNNEL_CONFIG"
+
+// path is the config file set with SetPath, usually from --config
+var path string
+
+// Config represents the main configuration structure. A config file may
+// include other files, such as a bastion list shared by a team. Entries are
+// merged field by field: the including file takes precedence over the files
+// it includes, and later includes over earlier ones.
+type Config struct {
+	// Include lists the config files this one builds on
+	Include []string `yaml:"include,omitempty"`
+
+	Bastions map[string]*BastionConfig `yaml:"bastions"`
+	// Tunnels are saved tunnel profiles, keyed by name
+	Tunnels map[string]*TunnelProfile `yaml:"tunnels,omitempty"`
+	// Contexts bundle a bastion with its tunnels and settings, keyed by name
+	Contexts map[string]*Context `yaml:"contexts,omitempty"`
+	// CurrentContext is the context used when no bastion is given
+	CurrentContext string `yaml:"current-context,omitempty"`
+
+	// Warnings describes the problems found while loading. Broken entries
+	// are still loaded, so that commands can fix them, but fail when used.
+	Warnings []string `yaml:"-"`
+
+	// included is the config merged from the included files alone, which
+	// SaveConfig leaves out of the user's own file
+	included *Config
+	// saveErr is set when layers couldn't be merged, since saving would then
+	// write included values into the user's own file, or drop entries
+	saveErr error
+}
+
+// BastionConfig holds the configuration for a single bastion server
+type BastionConfig struct {
+	Host     string `yaml:"host"`
+	User     string `yaml:"user"`
+	Port     int    `yaml:"port"`
+	AuthType string `yaml:"auth_type"` // "key", "password" or "agent"
+	KeyPath  string `yaml:"key_path,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// KeepAliveInterval is how often keepalive requests are sent; negative disables them
+	KeepAliveInterval time.Duration `yaml:"keepalive_interval,omitempty"`
+
+	// IdleTimeout closes tunnels that have had no connections for this long; 0 disables it
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+	// MaxLifetime closes tunnels this long after they were opened; 0 disables it
+	MaxLifetime time.Duration `yaml:"max_lifetime,omitempty"`
+
+	// ProxyJump names other bastions to hop through, in order, before this one
+	ProxyJump []string `yaml:"proxy_jump,omitempty"`
+
+	// Name is the key of this bastion in the config file
+	Name string `yaml:"-"`
+	// Jumps is the resolved chain of hops for ProxyJump, including their own jumps
+	Jumps []*BastionConfig `yaml:"-"`
+	// Sources lists the config files that define this bastion, lowest precedence first
+	Sources []string `yaml:"-"`
+	// Err is why the bastion can't be used, such as a broken proxy_jump chain
+	Err error `yaml:"-"`
+}
+
+// Route returns the names of every hop dialed to reach this bastion, ending with itself
+func (b *BastionConfig) Route() []string {
+	route := make([]string, 0, len(b.Jumps)+1)
+	for _, jump := range b.Jumps {
+		route = append(route, jump.Name)
+	}
+	return append(route, b.Name)
+}
+
+// RouteString returns the route as a readable chain such as "public -> internal -> db"
+func (b *BastionConfig) RouteString() string {
+	return strings.Join(b.Route(), " -> ")
+}
+
+// SetPath makes LoadConfig and SaveConfig use the given file. An empty path
+// restores the default lookup.
+func SetPath(p string) {
+	path = p
+}
+
+// Path returns the config file every command reads and writes: the path set
+// with SetPath, then $MYTUNNEL_CONFIG, then $XDG_CONFIG_HOME/mytunnel/config.yaml
+// (~/.config when unset) if it exists, and finally the legacy
+// ~/.mytunnel/config.yaml, which is also where a new config is created
+func Path() (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if env := os.Getenv(EnvPath); env != "" {
+		return env, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	xdgHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgHome == "" || !filepath.IsAbs(xdgHome) {
+		// The XDG spec says relative paths are invalid and must be ignored
+		xdgHome = filepath.Join(home, ".config")
+	}
+	xdgPath := filepath.Join(xdgHome, "mytunnel", "config.yaml")
+	if _, err := os.Stat(xdgPath); err == nil {
+		return xdgPath, nil
+	}
+
+	return filepath.Join(home, ".mytunnel", "config.yaml"), nil
+}
+
+// LoadConfig loads the configuration from the file returned by Path
+func LoadConfig() (*Config, error) {
+	configPath, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		// Return empty config if file doesn't exist
+		return &Config{Bastions: make(map[string]*BastionConfig)}, nil
+	}
+
+	layers, warnings, err := loadLayers(filepath.Clean(configPath))
+	if err != nil {
+		return nil, err
+	}
+	config, mergeWarnings := merge(layers)
+	config.Include = layers[len(layers)-1].Include
+	if len(layers) > 1 {
+		config.included, _ = merge(layers[:len(layers)-1])
+	}
+	config.Warnings = append(warnings, mergeWarnings...)
+	if len(config.Warnings) > 0 {
+		config.saveErr = fmt.Errorf("not saving %s until these problems are fixed by hand: %s", configPath, strings.Join(config.Warnings, "; "))
+	}
+
+	config.resolve()
+	for _, warning := range config.Warnings {
+		slog.Warn("problem in config file", "path", configPath, "problem", warning)
+	}
+
+	return config, nil
+}
+
+// SaveConfig saves the configuration to the file returned by Path
+func SaveConfig(config *Config) error {
+	configPath, err := Path()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// Marshal encodes the configuration as it is written to the config file,
+// leaving out what comes from included files
+func Marshal(config *Config) ([]byte, error) {
+	own, err := config.ownLayer()
+	if err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(own)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// AddBastion adds a new bastion configuration
+func (c *Config) AddBastion(name string, bastion *BastionConfig) {
+	if c.Bastions == nil {
+		c.Bastions = make(map[string]*BastionConfig)
+	}
+	bastion.Name = name
+	c.Bastions[name] = bastion
+}
+
+// resolve fills in the names and jump chains of every bastion, and marks the
+// entries that can't be used instead of failing, so that the commands which
+// fix them still work
+func (c *Config) resolve() {
+	if c.Bastions == nil {
+		c.Bastions = make(map[string]*BastionConfig)
+	}
+	for name, bastion := range c.Bastions {
+		bastion.Name = name
+	}
+	for _, name := range c.BastionNames() {
+		bastion := c.Bastions[name]
+		bastion.Jumps, bastion.Err = c.ResolveJumps(name)
+		if bastion.Err != nil {
+			c.Warnings = append(c.Warnings, bastion.Err.Error())
+		}
+	}
+	for _, name := range c.TunnelNames() {
+		profile := c.Tunnels[name]
+		profile.Name = name
+		if profile.Err = c.ValidateTunnel(name, profile); profile.Err != nil {
+			c.Warnings = append(c.Warnings, profile.Err.Error())
+		}
+	}
+	for _, name := range c.ContextNames() {
+		context := c.Contexts[name]
+		context.Name = name
+		if context.Err = c.ValidateContext(name, context); context.Err != nil {
+			c.Warnings = append(c.Warnings, context.Err.Error())
+		}
+	}
+	if c.CurrentContext != "" {
+		if _, ok := c.Contexts[c.CurrentContext]; !ok {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("current-context '%s' not found", c.CurrentContext))
+		}
+	}
+}
+
+// ResolveJumps returns the hops needed to reach a bastion, following the
+// proxy_jump entries of the jump hosts themselves. A host shared by several
+// jumps is only hopped through the first time it is reached.
+func (c *Config) ResolveJumps(name string) ([]*BastionConfig, error) {
+	jumps, err := c.resolveJumps(name, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(jumps))
+	unique := jumps[:0]
+	for _, jump := range jumps {
+		if !seen[jump.Name] {
+			seen[jump.Name] = true
+			unique = append(unique, jump)
+		}
+	}
+	return unique, nil
+}
+
+// resolveJumps walks proxy_jump references depth-first, rejecting cycles
+func (c *Config) resolveJumps(name string, visiting map[string]bool) ([]*BastionConfig, error) {
+	bastion, ok := c.Bastions[name]
+	if !ok {
+		return nil, fmt.Errorf("bastion '%s' not found", name)
+	}
+	if visiting[name] {
+		return nil, fmt.Errorf("bastion '%s': proxy_jump chain loops back on itself", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	var jumps []*BastionConfig
+	for _, jumpName := range bastion.ProxyJump {
+		jump, ok := c.Bastions[jumpName]
+		if !ok {
+			return nil, fmt.Errorf("bastion '%s': proxy_jump references unknown bastion '%s'", name, jumpName)
+		}
+		hops, err := c.resolveJumps(jumpName, visiting)
+		if err != nil {
+			return nil, err
+		}
+		jumps = append(jumps, hops...)
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
+
+// Redacted returns a copy of the config with passwords masked, for showing it
+func (c *Config) Redacted() *Config {
+	masked := *c
+	masked.Bastions = make(map[string]*BastionConfig, len(c.Bastions))
+	for name, bastion := range c.Bastions {
+		clone := *bastion
+		if clone.Password != "" {
+			clone.Password = "********"
+		}
+		masked.Bastions[name] = &clone
+	}
+	if c.included != nil {
+		masked.included = c.included.Redacted()
+	}
+	return &masked
+}
+
+// RemoveBastion removes a bastion configuration
+func (c *Config) RemoveBastion(name string) {
+	delete(c.Bastions, name)
+}
+
+// BastionNames returns the names of all bastions in alphabetical order
+func (c *Config) BastionNames() []string {
+	names := make([]string, 0, len(c.Bastions))
+	for name := range c.Bastions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetBastion retrieves a bastion configuration by name, failing if it is
+// missing or can't be used
+func (c *Config) GetBastion(name string) (*BastionConfig, error) {
+	bastion, ok := c.Bastions[name]
+	if !ok {
+		return nil, fmt.Errorf("bastion '%s' not found", name)
+	}
+	if bastion.Err != nil {
+		return nil, bastion.Err
+	}
+	return bastion, nil
 } 
\ No newline at end of file
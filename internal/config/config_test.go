@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveJumps(t *testing.T) {
+	cfg := &Config{Bastions: map[string]*BastionConfig{
+		"public":   {Host: "public.example.com"},
+		"internal": {Host: "internal", ProxyJump: []string{"public"}},
+		"admin":    {Host: "admin", ProxyJump: []string{"public"}},
+		"db":       {Host: "db", ProxyJump: []string{"internal", "admin"}},
+		"loop-a":   {Host: "a", ProxyJump: []string{"loop-b"}},
+		"loop-b":   {Host: "b", ProxyJump: []string{"loop-a"}},
+		"dangling": {Host: "d", ProxyJump: []string{"missing"}},
+	}}
+	for name, bastion := range cfg.Bastions {
+		bastion.Name = name
+	}
+
+	tests := []struct {
+		name    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "public", want: []string{}},
+		{name: "internal", want: []string{"public"}},
+		// public is shared by both jumps and only hopped through once
+		{name: "db", want: []string{"public", "internal", "admin"}},
+		{name: "loop-a", wantErr: true},
+		{name: "dangling", wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		jumps, err := cfg.ResolveJumps(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveJumps(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := make([]string, 0, len(jumps))
+		for _, jump := range jumps {
+			got = append(got, jump.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ResolveJumps(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
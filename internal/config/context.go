@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Context bundles a bastion with the tunnels and settings used with it, like
+// a kubeconfig context
+type Context struct {
+	// Bastion is the name of the bastion the context connects to
+	Bastion string `yaml:"bastion"`
+	// Tunnels names the tunnel profiles opened when the context is used
+	Tunnels []string `yaml:"tunnels,omitempty"`
+	// Refresh is how often ports are rediscovered; 0 uses the default
+	Refresh time.Duration `yaml:"refresh,omitempty"`
+
+	// Name is the key of this context in the config file
+	Name string `yaml:"-"`
+	// Err is why the context can't be used, if it is invalid
+	Err error `yaml:"-"`
+}
+
+// AddContext adds or replaces a context
+func (c *Config) AddContext(name string, context *Context) {
+	if c.Contexts == nil {
+		c.Contexts = make(map[string]*Context)
+	}
+	context.Name = name
+	c.Contexts[name] = context
+}
+
+// RemoveContext removes a context, unsetting it if it was the current one
+func (c *Config) RemoveContext(name string) {
+	delete(c.Contexts, name)
+	if c.CurrentContext == name {
+		c.CurrentContext = ""
+	}
+}
+
+// UseContext makes name the current context
+func (c *Config) UseContext(name string) error {
+	context, ok := c.Contexts[name]
+	if !ok {
+		return fmt.Errorf("context '%s' not found", name)
+	}
+	if context.Err != nil {
+		return context.Err
+	}
+	c.CurrentContext = name
+	return nil
+}
+
+// ContextNames returns the names of all contexts in alphabetical order
+func (c *Config) ContextNames() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ContextTunnels returns the tunnel profiles a context opens
+func (c *Config) ContextTunnels(context *Context) []*TunnelProfile {
+	profiles := make([]*TunnelProfile, 0, len(context.Tunnels))
+	for _, name := range context.Tunnels {
+		if profile, ok := c.Tunnels[name]; ok {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// ValidateContext checks that a context refers to a known bastion and
+// known tunnel profiles
+func (c *Config) ValidateContext(name string, context *Context) error {
+	if _, ok := c.Bastions[context.Bastion]; !ok {
+		return fmt.Errorf("context '%s' references unknown bastion '%s'", name, context.Bastion)
+	}
+	for _, tunnel := range context.Tunnels {
+		if _, ok := c.Tunnels[tunnel]; !ok {
+			return fmt.Errorf("context '%s' references unknown tunnel '%s'", name, tunnel)
+		}
+	}
+	if context.Refresh < 0 {
+		return fmt.Errorf("context '%s': refresh must not be negative", name)
+	}
+	return nil
+}
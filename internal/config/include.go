@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxIncludeDepth bounds nested include directives
+const maxIncludeDepth = 16
+
+// layer is one config file as written, before it is merged with the files it
+// includes. Entries are kept as YAML nodes so that a layer can set only some
+// fields of an entry defined in a file it includes.
+type layer struct {
+	path string
+	// key identifies the file however its path is spelled
+	key      string
+	Include  []string             `yaml:"include"`
+	Bastions map[string]yaml.Node `yaml:"bastions"`
+	Tunnels  map[string]yaml.Node `yaml:"tunnels"`
+	Contexts map[string]yaml.Node `yaml:"contexts"`
+	// CurrentContext is nil when the file doesn't set it, and may be blank
+	// to unset the current context of an included file
+	CurrentContext *string `yaml:"current-context"`
+}
+
+// loadLayers reads a config file and, before it, every file it includes.
+// Includes come out in the order they are listed, each after the files it
+// includes itself, so that later layers take precedence over earlier ones.
+// A file included more than once takes the position of its last include.
+// Only a problem with the file itself is an error: included files that
+// can't be read are left out and reported as warnings.
+func loadLayers(path string) ([]*layer, []string, error) {
+	var warnings []string
+	layers, err := walkLayers(path, map[string]bool{}, 0, &warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := make(map[string]int, len(layers))
+	for i, l := range layers {
+		last[l.key] = i
+	}
+	unique := layers[:0]
+	for i, l := range layers {
+		if last[l.key] == i {
+			unique = append(unique, l)
+		}
+	}
+	return unique, warnings, nil
+}
+
+// walkLayers reads a file and the files it includes, depth-first, skipping
+// include cycles
+func walkLayers(path string, visiting map[string]bool, depth int, warnings *[]string) ([]*layer, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("%s: too many nested includes", path)
+	}
+	key := fileKey(path)
+	if visiting[key] {
+		return nil, fmt.Errorf("%s: include loops back on itself", path)
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	top := &layer{path: path, key: key}
+	if err := yaml.Unmarshal(data, top); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	var layers []*layer
+	for _, pattern := range top.Include {
+		files, err := includeFiles(path, pattern)
+		if err != nil {
+			*warnings = append(*warnings, err.Error())
+			continue
+		}
+		for _, file := range files {
+			included, err := walkLayers(file, visiting, depth+1, warnings)
+			if err != nil {
+				*warnings = append(*warnings, err.Error())
+				continue
+			}
+			layers = append(layers, included...)
+		}
+	}
+	return append(layers, top), nil
+}
+
+// fileKey returns the absolute path of a file with symlinks resolved, so
+// that a file reached through different paths is recognized
+func fileKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+// includeFiles returns the files an include entry refers to. Relative paths
+// are resolved against the directory of the including file, and patterns
+// with wildcards may match no file at all.
+func includeFiles(from, pattern string) ([]string, error) {
+	if strings.HasPrefix(pattern, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		pattern = filepath.Join(home, pattern[2:])
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(from), pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err := os.Stat(pattern); err != nil {
+			return nil, fmt.Errorf("%s: failed to include config file: %w", from, err)
+		}
+		return []string{pattern}, nil
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid include pattern %q: %w", from, pattern, err)
+	}
+	return files, nil
+}
+
+// merge builds a config from layers, lowest precedence first. An entry
+// defined in several layers is decoded from each in turn, so fields set in a
+// later layer replace the earlier values and the rest are kept. Malformed
+// entries are skipped and reported as warnings.
+func merge(layers []*layer) (*Config, []string) {
+	c := &Config{
+		Bastions: make(map[string]*BastionConfig),
+		Tunnels:  make(map[string]*TunnelProfile),
+		Contexts: make(map[string]*Context),
+	}
+	var warnings []string
+	for _, l := range layers {
+		for name, node := range l.Bastions {
+			bastion, err := mergeEntry(c.Bastions, name, node)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: bastion '%s': %v", l.path, name, err))
+				continue
+			}
+			bastion.Sources = append(bastion.Sources, l.path)
+		}
+		for name, node := range l.Tunnels {
+			if _, err := mergeEntry(c.Tunnels, name, node); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: tunnel '%s': %v", l.path, name, err))
+			}
+		}
+		for name, node := range l.Contexts {
+			if _, err := mergeEntry(c.Contexts, name, node); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: context '%s': %v", l.path, name, err))
+			}
+		}
+		if l.CurrentContext != nil {
+			c.CurrentContext = *l.CurrentContext
+		}
+	}
+	return c, warnings
+}
+
+// mergeEntry decodes one layer's entry over the value from the layers
+// before it, leaving that value untouched if the entry is malformed
+func mergeEntry[T any](entries map[string]*T, name string, node yaml.Node) (*T, error) {
+	var merged T
+	entry, ok := entries[name]
+	if ok {
+		merged = *entry
+	}
+	if err := node.Decode(&merged); err != nil {
+		return nil, err
+	}
+	if !ok {
+		entry = new(T)
+		entries[name] = entry
+	}
+	*entry = merged
+	return entry, nil
+}
+
+// userLayer is the part of a config that belongs in the user's own file:
+// entries that aren't in any included file, and for entries that are, the
+// fields that differ from the included values
+type userLayer struct {
+	Include        []string       `yaml:"include,omitempty"`
+	Bastions       map[string]any `yaml:"bastions"`
+	Tunnels        map[string]any `yaml:"tunnels,omitempty"`
+	Contexts       map[string]any `yaml:"contexts,omitempty"`
+	CurrentContext *string        `yaml:"current-context,omitempty"`
+}
+
+// ownLayer splits the user's layer off a merged config
+func (c *Config) ownLayer() (*userLayer, error) {
+	if c.saveErr != nil {
+		return nil, c.saveErr
+	}
+	base := c.included
+	if base == nil {
+		base = &Config{}
+	}
+
+	own := &userLayer{
+		Include:  c.Include,
+		Bastions: make(map[string]any),
+	}
+	if c.CurrentContext != base.CurrentContext {
+		own.CurrentContext = &c.CurrentContext
+	}
+
+	var err error
+	if own.Bastions, err = overrides("bastion", c.Bastions, base.Bastions); err != nil {
+		return nil, err
+	}
+	if own.Tunnels, err = overrides("tunnel profile", c.Tunnels, base.Tunnels); err != nil {
+		return nil, err
+	}
+	if own.Contexts, err = overrides("context", c.Contexts, base.Contexts); err != nil {
+		return nil, err
+	}
+	return own, nil
+}
+
+// overrides returns the entries of merged as they must be written to the
+// user's layer on top of the included ones. Included entries can't be
+// removed from the user's layer, so a missing one is an error.
+func overrides[T any](kind string, merged, included map[string]*T) (map[string]any, error) {
+	for name := range included {
+		if _, ok := merged[name]; !ok {
+			return nil, fmt.Errorf("%s '%s' is defined in an included config file and can only be removed there", kind, name)
+		}
+	}
+
+	own := make(map[string]any, len(merged))
+	for name, entry := range merged {
+		under, ok := included[name]
+		if !ok {
+			own[name] = entry
+			continue
+		}
+		changed, err := changedFields(entry, under)
+		if err != nil {
+			return nil, err
+		}
+		if changed != nil {
+			own[name] = changed
+		}
+	}
+	return own, nil
+}
+
+// changedFields returns a mapping node with the fields of entry that differ
+// from under, or nil if there are none. A field cleared in entry is written
+// as its zero value, since leaving it out would bring back the included one.
+func changedFields(entry, under any) (*yaml.Node, error) {
+	var node, underNode yaml.Node
+	if err := node.Encode(entry); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := underNode.Encode(under); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	values, underValues := mappingValues(&node), mappingValues(&underNode)
+
+	changed := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	t := reflect.TypeOf(entry).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		value, set := values[key]
+		old, wasSet := underValues[key]
+		switch {
+		case !set && !wasSet:
+			continue
+		case !set:
+			// Left out by omitempty
+			value = &yaml.Node{}
+			if err := value.Encode(reflect.Zero(t.Field(i).Type).Interface()); err != nil {
+				return nil, fmt.Errorf("failed to marshal config: %w", err)
+			}
+		case wasSet && sameNode(value, old):
+			continue
+		}
+		changed.Content = append(changed.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	}
+	if len(changed.Content) == 0 {
+		return nil, nil
+	}
+	return changed, nil
+}
+
+// mappingValues indexes the values of a mapping node by key
+func mappingValues(node *yaml.Node) map[string]*yaml.Node {
+	values := make(map[string]*yaml.Node, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		values[node.Content[i].Value] = node.Content[i+1]
+	}
+	return values
+}
+
+// sameNode reports whether two nodes encode the same value
+func sameNode(a, b *yaml.Node) bool {
+	x, errA := yaml.Marshal(a)
+	y, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
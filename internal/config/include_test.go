@@ -0,0 +1,388 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates the given files in dir, keyed by name
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// loadFiles writes files to a new directory and loads its config.yaml
+func loadFiles(t *testing.T, files map[string]string) (*Config, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	SetPath(filepath.Join(dir, "config.yaml"))
+	t.Cleanup(func() { SetPath("") })
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	return cfg, dir
+}
+
+func TestIncludePrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    BastionConfig
+		sources []string
+		current string
+	}{
+		{
+			name: "user layer over include",
+			files: map[string]string{
+				"config.yaml": "include: [team.yaml]\nbastions:\n  web:\n    host: mine.example.com\n",
+				"team.yaml":   "bastions:\n  web:\n    host: team.example.com\n    user: deploy\n    port: 22\n",
+			},
+			want:    BastionConfig{Host: "mine.example.com", User: "deploy", Port: 22},
+			sources: []string{"team.yaml", "config.yaml"},
+		},
+		{
+			name: "later include over earlier",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml, b.yaml]\n",
+				"a.yaml":      "bastions:\n  web:\n    host: a.example.com\n    user: a\n    port: 22\n",
+				"b.yaml":      "bastions:\n  web:\n    host: b.example.com\n",
+			},
+			want:    BastionConfig{Host: "b.example.com", User: "a", Port: 22},
+			sources: []string{"a.yaml", "b.yaml"},
+		},
+		{
+			name: "file included twice takes its last position",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml, b.yaml, a.yaml]\n",
+				"a.yaml":      "bastions:\n  web:\n    host: a.example.com\n",
+				"b.yaml":      "bastions:\n  web:\n    host: b.example.com\n    user: b\n",
+			},
+			want:    BastionConfig{Host: "a.example.com", User: "b"},
+			sources: []string{"b.yaml", "a.yaml"},
+		},
+		{
+			name: "file included twice through another include",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml, b.yaml]\n",
+				"a.yaml":      "bastions:\n  web:\n    host: a.example.com\n    user: a\n",
+				"b.yaml":      "include: [./a.yaml]\nbastions:\n  web:\n    host: b.example.com\n",
+			},
+			want:    BastionConfig{Host: "b.example.com", User: "a"},
+			sources: []string{"a.yaml", "b.yaml"},
+		},
+		{
+			name: "current context unset by the user layer",
+			files: map[string]string{
+				"config.yaml": "include: [team.yaml]\ncurrent-context: \"\"\nbastions: {}\n",
+				"team.yaml":   "current-context: prod\nbastions:\n  web:\n    host: team.example.com\ncontexts:\n  prod:\n    bastion: web\n",
+			},
+			want:    BastionConfig{Host: "team.example.com"},
+			sources: []string{"team.yaml"},
+		},
+		{
+			name: "current context from an include",
+			files: map[string]string{
+				"config.yaml": "include: [team.yaml]\nbastions: {}\n",
+				"team.yaml":   "current-context: prod\nbastions:\n  web:\n    host: team.example.com\ncontexts:\n  prod:\n    bastion: web\n",
+			},
+			want:    BastionConfig{Host: "team.example.com"},
+			sources: []string{"team.yaml"},
+			current: "prod",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, dir := loadFiles(t, tt.files)
+			if len(cfg.Warnings) > 0 {
+				t.Fatalf("unexpected warnings: %q", cfg.Warnings)
+			}
+			web, err := cfg.GetBastion("web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := BastionConfig{Host: web.Host, User: web.User, Port: web.Port}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("web = %+v, want %+v", got, tt.want)
+			}
+			var sources []string
+			for _, source := range web.Sources {
+				rel, _ := filepath.Rel(dir, source)
+				sources = append(sources, rel)
+			}
+			if !reflect.DeepEqual(sources, tt.sources) {
+				t.Errorf("web.Sources = %q, want %q", sources, tt.sources)
+			}
+			if cfg.CurrentContext != tt.current {
+				t.Errorf("CurrentContext = %q, want %q", cfg.CurrentContext, tt.current)
+			}
+		})
+	}
+}
+
+func TestSaveConfigOverrides(t *testing.T) {
+	team := `current-context: prod
+bastions:
+  web:
+    host: team.example.com
+    user: deploy
+    port: 22
+    auth_type: key
+    key_path: ~/.ssh/team
+    keepalive_interval: 30s
+contexts:
+  prod:
+    bastion: web
+`
+	tests := []struct {
+		name   string
+		change func(*Config)
+		// own is what the user's file must contain afterwards
+		own   []string
+		check func(*testing.T, *Config)
+	}{
+		{
+			name:   "unchanged config writes no overrides",
+			change: func(*Config) {},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Bastions["web"].KeyPath != "~/.ssh/team" {
+					t.Errorf("key_path = %q, want the included value", cfg.Bastions["web"].KeyPath)
+				}
+			},
+		},
+		{
+			name: "changed field",
+			change: func(cfg *Config) {
+				cfg.Bastions["web"].User = "alice"
+			},
+			own: []string{"user: alice"},
+			check: func(t *testing.T, cfg *Config) {
+				if web := cfg.Bastions["web"]; web.User != "alice" || web.Host != "team.example.com" {
+					t.Errorf("web = %+v, want user alice on the included host", web)
+				}
+			},
+		},
+		{
+			name: "cleared fields",
+			change: func(cfg *Config) {
+				web := cfg.Bastions["web"]
+				web.AuthType = "agent"
+				web.KeyPath = ""
+				web.KeepAliveInterval = 0
+			},
+			own: []string{"auth_type: agent", `key_path: ""`, "keepalive_interval: 0s"},
+			check: func(t *testing.T, cfg *Config) {
+				web := cfg.Bastions["web"]
+				if web.KeyPath != "" || web.KeepAliveInterval != 0 {
+					t.Errorf("web = %+v, want key_path and keepalive_interval cleared", web)
+				}
+			},
+		},
+		{
+			name: "cleared current context",
+			change: func(cfg *Config) {
+				cfg.CurrentContext = ""
+			},
+			own: []string{`current-context: ""`},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.CurrentContext != "" {
+					t.Errorf("CurrentContext = %q, want it unset", cfg.CurrentContext)
+				}
+			},
+		},
+		{
+			name: "new entry",
+			change: func(cfg *Config) {
+				cfg.AddBastion("db", &BastionConfig{Host: "db.example.com", User: "root", Port: 22, AuthType: "agent"})
+			},
+			own: []string{"db:", "host: db.example.com"},
+			check: func(t *testing.T, cfg *Config) {
+				if _, err := cfg.GetBastion("db"); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, dir := loadFiles(t, map[string]string{
+				"config.yaml": "include: [team.yaml]\nbastions: {}\n",
+				"team.yaml":   team,
+			})
+			tt.change(cfg)
+			if err := SaveConfig(cfg); err != nil {
+				t.Fatalf("SaveConfig() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "team.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != team {
+				t.Errorf("SaveConfig() changed the included file:\n%s", data)
+			}
+			own, err := os.ReadFile(filepath.Join(dir, "config.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(own), "team.example.com") {
+				t.Errorf("user file repeats included values:\n%s", own)
+			}
+			for _, want := range tt.own {
+				if !strings.Contains(string(own), want) {
+					t.Errorf("user file is missing %q:\n%s", want, own)
+				}
+			}
+
+			reloaded, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			tt.check(t, reloaded)
+		})
+	}
+}
+
+func TestSaveConfigRejectsRemovedIncludedEntry(t *testing.T) {
+	cfg, _ := loadFiles(t, map[string]string{
+		"config.yaml": "include: [team.yaml]\nbastions: {}\n",
+		"team.yaml":   "bastions:\n  web:\n    host: team.example.com\n",
+	})
+	cfg.RemoveBastion("web")
+	if err := SaveConfig(cfg); err == nil {
+		t.Error("SaveConfig() succeeded, want an error for a bastion defined in an included file")
+	}
+}
+
+func TestLoadConfigWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		warnings int
+	}{
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.yaml": "include: [missing.yaml]\nbastions:\n  web:\n    host: web.example.com\n",
+			},
+			warnings: 1,
+		},
+		{
+			name: "include pattern matching nothing",
+			files: map[string]string{
+				"config.yaml": "include: [conf.d/*.yaml]\nbastions:\n  web:\n    host: web.example.com\n",
+			},
+		},
+		{
+			name: "unparsable include",
+			files: map[string]string{
+				"config.yaml": "include: [broken.yaml]\nbastions:\n  web:\n    host: web.example.com\n",
+				"broken.yaml": "bastions: [not, a, map\n",
+			},
+			warnings: 1,
+		},
+		{
+			name: "include loop",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\nbastions:\n  web:\n    host: web.example.com\n",
+				"a.yaml":      "include: [config.yaml]\n",
+			},
+			warnings: 1,
+		},
+		{
+			name: "malformed entry",
+			files: map[string]string{
+				"config.yaml": "bastions:\n  web:\n    host: web.example.com\n  db:\n    port: not-a-number\n",
+			},
+			warnings: 1,
+		},
+		{
+			name: "malformed override keeps the included entry",
+			files: map[string]string{
+				"config.yaml": "include: [team.yaml]\nbastions:\n  web:\n    keepalive_interval: often\n",
+				"team.yaml":   "bastions:\n  web:\n    host: web.example.com\n",
+			},
+			warnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := loadFiles(t, tt.files)
+			if len(cfg.Warnings) != tt.warnings {
+				t.Errorf("Warnings = %q, want %d", cfg.Warnings, tt.warnings)
+			}
+			web, err := cfg.GetBastion("web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if web.Host != "web.example.com" || web.KeepAliveInterval != time.Duration(0) {
+				t.Errorf("web = %+v, want it loaded despite the problems", web)
+			}
+			if err := SaveConfig(cfg); (err != nil) != (tt.warnings > 0) {
+				t.Errorf("SaveConfig() error = %v, want an error only when there are warnings", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBrokenFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.yaml": "bastions: [not, a, map\n"})
+	SetPath(filepath.Join(dir, "config.yaml"))
+	t.Cleanup(func() { SetPath("") })
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() succeeded, want an error for an unparsable config file")
+	}
+}
+
+func TestLoadLayersPathSpellings(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": "include: [team.yaml, ./team.yaml, link.yaml]\n",
+		"team.yaml":   "bastions: {}\n",
+	})
+	if err := os.Symlink(filepath.Join(dir, "team.yaml"), filepath.Join(dir, "link.yaml")); err != nil {
+		t.Skip(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	layers, warnings, err := loadLayers("config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("warnings = %q, want none", warnings)
+	}
+	if len(layers) != 2 {
+		t.Errorf("got %d layers, want team.yaml once and config.yaml", len(layers))
+	}
+
+	// The root spelled relatively is still found when it includes itself
+	writeFiles(t, dir, map[string]string{"config.yaml": "include: [" + filepath.Join(dir, "config.yaml") + "]\n"})
+	if _, warnings, err = loadLayers("config.yaml"); err != nil || len(warnings) != 1 {
+		t.Errorf("loadLayers() = %q, %v, want one include loop warning", warnings, err)
+	}
+}
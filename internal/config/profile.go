@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TunnelProfile is a saved tunnel that can be reopened by name
+type TunnelProfile struct {
+	// Bastion is the name of the bastion the tunnel goes through
+	Bastion string `yaml:"bastion"`
+	// Type is local, remote or dynamic; blank means local
+	Type      string `yaml:"type,omitempty"`
+	LocalPort int    `yaml:"local_port"`
+	// RemoteHost and RemotePort are the target of local tunnels, and
+	// RemotePort is the bastion port of remote tunnels
+	RemoteHost string `yaml:"remote_host,omitempty"`
+	RemotePort int    `yaml:"remote_port,omitempty"`
+	// Label is a free-form description shown next to the profile
+	Label string `yaml:"label,omitempty"`
+	// Autostart opens the tunnel whenever mytunnel or its daemon starts
+	Autostart bool `yaml:"autostart,omitempty"`
+
+	// Name is the key of this profile in the config file
+	Name string `yaml:"-"`
+	// Err is why the profile can't be opened, if it is invalid
+	Err error `yaml:"-"`
+}
+
+// AddTunnel adds or replaces a tunnel profile
+func (c *Config) AddTunnel(name string, profile *TunnelProfile) {
+	if c.Tunnels == nil {
+		c.Tunnels = make(map[string]*TunnelProfile)
+	}
+	profile.Name = name
+	c.Tunnels[name] = profile
+}
+
+// RemoveTunnel removes a tunnel profile
+func (c *Config) RemoveTunnel(name string) {
+	delete(c.Tunnels, name)
+}
+
+// TunnelNames returns the names of all tunnel profiles in alphabetical order
+func (c *Config) TunnelNames() []string {
+	names := make([]string, 0, len(c.Tunnels))
+	for name := range c.Tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateTunnel checks that a profile refers to a known bastion and has
+// the ports its type needs
+func (c *Config) ValidateTunnel(name string, profile *TunnelProfile) error {
+	if _, ok := c.Bastions[profile.Bastion]; !ok {
+		return fmt.Errorf("tunnel '%s' references unknown bastion '%s'", name, profile.Bastion)
+	}
+	if profile.LocalPort <= 0 || profile.LocalPort > 65535 {
+		return fmt.Errorf("tunnel '%s': invalid local_port %d", name, profile.LocalPort)
+	}
+
+	switch profile.Type {
+	case "", "local":
+		if profile.RemotePort <= 0 || profile.RemotePort > 65535 {
+			return fmt.Errorf("tunnel '%s': invalid remote_port %d", name, profile.RemotePort)
+		}
+	case "remote":
+		if profile.RemotePort < 0 || profile.RemotePort > 65535 {
+			return fmt.Errorf("tunnel '%s': invalid remote_port %d", name, profile.RemotePort)
+		}
+	case "dynamic":
+	default:
+		return fmt.Errorf("tunnel '%s': invalid type '%s': must be one of local, remote or dynamic", name, profile.Type)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"mytunnel/internal/logging"
+)
+
+// pingTimeout bounds how long Dial waits for the daemon to answer
+const pingTimeout = time.Second
+
+// ErrNotRunning is returned by Dial when no daemon is listening on the socket
+var ErrNotRunning = errors.New("daemon is not running")
+
+// Client is a Controller that talks to a running daemon
+type Client struct {
+	http *http.Client
+}
+
+// Dial connects to the daemon listening on socketPath
+func Dial(socketPath string) (*Client, error) {
+	client := &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := client.do(ctx, http.MethodGet, "/ping", nil, nil); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	return client, nil
+}
+
+// Open implements Controller
+func (c *Client) Open(ctx context.Context, req OpenRequest) (TunnelInfo, error) {
+	var tunnel TunnelInfo
+	err := c.do(ctx, http.MethodPost, "/tunnels", req, &tunnel)
+	return tunnel, err
+}
+
+// List implements Controller
+func (c *Client) List(ctx context.Context) ([]TunnelInfo, error) {
+	var tunnels []TunnelInfo
+	err := c.do(ctx, http.MethodGet, "/tunnels", nil, &tunnels)
+	return tunnels, err
+}
+
+// Close implements Controller
+func (c *Client) Close(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/tunnels/"+url.PathEscape(id), nil, nil)
+}
+
+// Extend implements Controller
+func (c *Client) Extend(ctx context.Context, id string) (TunnelInfo, error) {
+	var tunnel TunnelInfo
+	err := c.do(ctx, http.MethodPost, "/tunnels/"+url.PathEscape(id)+"/extend", nil, &tunnel)
+	return tunnel, err
+}
+
+// Events implements Controller
+func (c *Client) Events(ctx context.Context) (<-chan EventInfo, error) {
+	resp, err := c.request(ctx, http.MethodGet, "/events", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan EventInfo)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+		for {
+			var event EventInfo
+			if err := decoder.Decode(&event); err != nil {
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Entries implements logging.Source with the daemon's recent log entries.
+// Entries are empty if the daemon can't be reached.
+func (c *Client) Entries(tunnel string) []logging.Entry {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	var entries []logging.Entry
+	if err := c.do(ctx, http.MethodGet, "/logs?tunnel="+url.QueryEscape(tunnel), nil, &entries); err != nil {
+		return nil
+	}
+	return entries
+}
+
+// Shutdown asks the daemon to close its tunnels and exit
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/shutdown", nil, nil)
+}
+
+// do sends a request with body encoded as JSON and decodes the response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode daemon response: %w", err)
+	}
+	return nil
+}
+
+// request sends a request to the daemon, turning error responses into errors
+func (c *Client) request(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://mytunnel"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		var apiErr apiError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return nil, fmt.Errorf("daemon returned %s", resp.Status)
+		}
+		return nil, errors.New(apiErr.Error)
+	}
+	return resp, nil
+}
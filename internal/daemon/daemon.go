@@ -0,0 +1,140 @@
+// Package daemon lets tunnels outlive the UI. A daemon process owns the
+// TunnelManager and serves a Controller over a Unix socket; the UI and CLI
+// drive tunnels through the same Controller interface, either in-process or
+// as clients of the daemon.
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mytunnel/internal/ssh"
+)
+
+// TunnelInfo is a snapshot of a tunnel as reported by a Controller
+type TunnelInfo struct {
+	ID         string           `json:"id"`
+	Type       ssh.TunnelType   `json:"type"`
+	Bastion    string           `json:"bastion"`
+	LocalPort  int              `json:"local_port"`
+	RemoteHost string           `json:"remote_host,omitempty"`
+	RemotePort int              `json:"remote_port"`
+	State      ssh.TunnelState  `json:"state"`
+	Retries    int              `json:"retries,omitempty"`
+	LastError  string           `json:"last_error,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Stats      ssh.TunnelStats  `json:"stats"`
+	Limits     ssh.TunnelLimits `json:"limits"`
+	// ExpiresAt is when the tunnel will be closed by its limits, zero if never
+	ExpiresAt    time.Time `json:"expires_at"`
+	ExpiryReason string    `json:"expiry_reason,omitempty"`
+}
+
+// Port returns the port the tunnel listens on: the bastion port for remote
+// tunnels and the local port otherwise
+func (t TunnelInfo) Port() int {
+	if t.Type == ssh.RemoteTunnel {
+		return t.RemotePort
+	}
+	return t.LocalPort
+}
+
+// OpenRequest describes a tunnel to open
+type OpenRequest struct {
+	Type ssh.TunnelType `json:"type"`
+	// Bastion is the name of the bastion in the config file
+	Bastion    string `json:"bastion"`
+	LocalPort  int    `json:"local_port"`
+	RemoteHost string `json:"remote_host,omitempty"`
+	// RemotePort is the target port for local tunnels and the bastion port
+	// for remote tunnels, where 0 lets the bastion pick one
+	RemotePort int `json:"remote_port"`
+	// Limits overrides the bastion's idle timeout and max lifetime when set
+	Limits *ssh.TunnelLimits `json:"limits,omitempty"`
+}
+
+// EventInfo is a tunnel event as reported by a Controller
+type EventInfo struct {
+	Type    ssh.EventType `json:"type"`
+	Tunnel  string        `json:"tunnel"`
+	Time    time.Time     `json:"time"`
+	Message string        `json:"message,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Attempt int           `json:"attempt,omitempty"`
+	Peer    string        `json:"peer,omitempty"`
+}
+
+// Controller opens, lists and closes tunnels
+type Controller interface {
+	// Open creates a tunnel and waits until it is connected
+	Open(ctx context.Context, req OpenRequest) (TunnelInfo, error)
+	// List returns every tunnel ordered by type and port
+	List(ctx context.Context) ([]TunnelInfo, error)
+	// Close closes the tunnel with the given ID
+	Close(ctx context.Context, id string) error
+	// Extend restarts the idle and lifetime clocks of a tunnel
+	Extend(ctx context.Context, id string) (TunnelInfo, error)
+	// Events streams tunnel events until ctx is cancelled
+	Events(ctx context.Context) (<-chan EventInfo, error)
+}
+
+// DefaultSocketPath returns the path of the daemon's control socket
+func DefaultSocketPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".mytunnel", "mytunnel.sock"), nil
+}
+
+// tunnelInfo takes a snapshot of a tunnel
+func tunnelInfo(tunnel *ssh.Tunnel) TunnelInfo {
+	status := tunnel.Status()
+	// The bastion port of a remote tunnel is set once the bastion allocates it
+	var remotePort int
+	if tunnel.Type == ssh.RemoteTunnel {
+		remotePort = tunnel.Port()
+	} else {
+		remotePort = tunnel.RemotePort
+	}
+	info := TunnelInfo{
+		ID:         tunnel.ID(),
+		Type:       tunnel.Type,
+		Bastion:    tunnel.Bastion.Name,
+		LocalPort:  tunnel.LocalPort,
+		RemoteHost: tunnel.RemoteHost,
+		RemotePort: remotePort,
+		State:      status.State,
+		Retries:    status.Retries,
+		CreatedAt:  status.CreatedAt,
+		Stats:      tunnel.Stats(),
+		Limits:     tunnel.Limits(),
+	}
+	if status.LastError != nil {
+		info.LastError = status.LastError.Error()
+	}
+	if expiry, ok := tunnel.Expiry(); ok {
+		info.ExpiresAt = expiry.At
+		info.ExpiryReason = expiry.Reason
+	}
+	return info
+}
+
+// eventInfo converts a tunnel event for reporting
+func eventInfo(event ssh.Event) EventInfo {
+	info := EventInfo{
+		Type:    event.Type,
+		Tunnel:  event.Tunnel.ID(),
+		Time:    event.Time,
+		Message: event.Message,
+		Attempt: event.Attempt,
+		Peer:    event.Peer,
+	}
+	if event.Err != nil {
+		info.Error = event.Err.Error()
+	}
+	return info
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"mytunnel/internal/config"
+	"mytunnel/internal/ssh"
+)
+
+// BastionLookup resolves a bastion by its name in the config file
+type BastionLookup func(name string) (*config.BastionConfig, error)
+
+// LoadBastion is a BastionLookup that reads the config file on every call,
+// so bastions added after startup can be used
+func LoadBastion(name string) (*config.BastionConfig, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.GetBastion(name)
+}
+
+// Local is a Controller that runs tunnels in the current process
+type Local struct {
+	manager  *ssh.TunnelManager
+	bastions BastionLookup
+}
+
+// NewLocal creates a Controller for the tunnels of manager
+func NewLocal(manager *ssh.TunnelManager, bastions BastionLookup) *Local {
+	return &Local{manager: manager, bastions: bastions}
+}
+
+// Open implements Controller
+func (l *Local) Open(ctx context.Context, req OpenRequest) (TunnelInfo, error) {
+	bastion, err := l.bastions(req.Bastion)
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+
+	var id string
+	switch req.Type {
+	case ssh.LocalTunnel:
+		err = l.manager.CreateTunnelContext(ctx, req.LocalPort, req.RemoteHost, req.RemotePort, bastion)
+		id = ssh.TunnelID(req.Type, req.LocalPort)
+	case ssh.DynamicTunnel:
+		err = l.manager.CreateDynamicTunnelContext(ctx, req.LocalPort, bastion)
+		id = ssh.TunnelID(req.Type, req.LocalPort)
+	case ssh.RemoteTunnel:
+		var remotePort int
+		remotePort, err = l.manager.CreateReverseTunnelContext(ctx, req.RemotePort, req.LocalPort, bastion)
+		id = ssh.TunnelID(req.Type, remotePort)
+	default:
+		err = fmt.Errorf("invalid tunnel type %d", req.Type)
+	}
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+
+	tunnel, ok := l.manager.FindTunnel(id)
+	if !ok {
+		return TunnelInfo{}, fmt.Errorf("tunnel %s was closed right after opening", id)
+	}
+	if req.Limits != nil {
+		tunnel.SetLimits(*req.Limits)
+	}
+	return tunnelInfo(tunnel), nil
+}
+
+// List implements Controller
+func (l *Local) List(ctx context.Context) ([]TunnelInfo, error) {
+	tunnels := append(l.manager.ListTunnels(), l.manager.ListReverseTunnels()...)
+	infos := make([]TunnelInfo, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		infos = append(infos, tunnelInfo(tunnel))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Type != infos[j].Type {
+			return infos[i].Type < infos[j].Type
+		}
+		return infos[i].Port() < infos[j].Port()
+	})
+	return infos, nil
+}
+
+// Close implements Controller
+func (l *Local) Close(ctx context.Context, id string) error {
+	tunnel, ok := l.manager.FindTunnel(id)
+	if !ok {
+		return fmt.Errorf("no tunnel with ID %s", id)
+	}
+	if tunnel.Type == ssh.RemoteTunnel {
+		return l.manager.CloseReverseTunnel(tunnel.Port())
+	}
+	return l.manager.CloseTunnel(tunnel.LocalPort)
+}
+
+// Extend implements Controller
+func (l *Local) Extend(ctx context.Context, id string) (TunnelInfo, error) {
+	tunnel, ok := l.manager.FindTunnel(id)
+	if !ok {
+		return TunnelInfo{}, fmt.Errorf("no tunnel with ID %s", id)
+	}
+	tunnel.Extend()
+	return tunnelInfo(tunnel), nil
+}
+
+// Events implements Controller
+func (l *Local) Events(ctx context.Context) (<-chan EventInfo, error) {
+	events, unsubscribe := l.manager.Subscribe()
+	infos := make(chan EventInfo)
+	go func() {
+		defer close(infos)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case infos <- eventInfo(event):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return infos, nil
+}
@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"mytunnel/internal/config"
+	"mytunnel/internal/ssh"
+)
+
+// ProfileRequest builds the request that opens a saved tunnel profile
+func ProfileRequest(profile *config.TunnelProfile) (OpenRequest, error) {
+	if profile.Err != nil {
+		return OpenRequest{}, profile.Err
+	}
+	tunnelType := ssh.LocalTunnel
+	if profile.Type != "" {
+		var err error
+		if tunnelType, err = ssh.ParseTunnelType(profile.Type); err != nil {
+			return OpenRequest{}, fmt.Errorf("tunnel '%s': %w", profile.Name, err)
+		}
+	}
+	return OpenRequest{
+		Type:       tunnelType,
+		Bastion:    profile.Bastion,
+		LocalPort:  profile.LocalPort,
+		RemoteHost: profile.RemoteHost,
+		RemotePort: profile.RemotePort,
+	}, nil
+}
+
+// NewProfile creates a profile that reopens the given tunnel
+func NewProfile(tunnel TunnelInfo) *config.TunnelProfile {
+	profile := &config.TunnelProfile{
+		Bastion:    tunnel.Bastion,
+		LocalPort:  tunnel.LocalPort,
+		RemoteHost: tunnel.RemoteHost,
+		RemotePort: tunnel.RemotePort,
+	}
+	if tunnel.Type != ssh.LocalTunnel {
+		profile.Type = tunnel.Type.String()
+	}
+	return profile
+}
+
+// Matches reports whether tunnel is what the request would open. A remote
+// tunnel that lets the bastion pick its port matches on the local side only.
+func (r OpenRequest) Matches(tunnel TunnelInfo) bool {
+	if r.Type != tunnel.Type || r.Bastion != tunnel.Bastion || r.LocalPort != tunnel.LocalPort {
+		return false
+	}
+	switch r.Type {
+	case ssh.LocalTunnel:
+		// A blank target host is opened as localhost
+		host := r.RemoteHost
+		if host == "" {
+			host = "localhost"
+		}
+		return host == tunnel.RemoteHost && r.RemotePort == tunnel.RemotePort
+	case ssh.RemoteTunnel:
+		return r.RemotePort == 0 || r.RemotePort == tunnel.RemotePort
+	default:
+		return true
+	}
+}
+
+// Autostart opens every autostart profile in cfg that isn't already open.
+// Profiles that fail don't stop the others; their errors are joined.
+func Autostart(ctx context.Context, c Controller, cfg *config.Config) error {
+	return OpenProfiles(ctx, c, AutostartProfiles(cfg))
+}
+
+// AutostartProfiles returns the profiles of cfg marked autostart, by name
+func AutostartProfiles(cfg *config.Config) []*config.TunnelProfile {
+	var profiles []*config.TunnelProfile
+	for _, name := range cfg.TunnelNames() {
+		if profile := cfg.Tunnels[name]; profile.Autostart {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// OpenProfiles opens the given profiles, skipping those already open and
+// those listed twice. Profiles that fail don't stop the others; their
+// errors are joined.
+func OpenProfiles(ctx context.Context, c Controller, profiles []*config.TunnelProfile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	open, err := c.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	var errs []error
+	seen := make(map[string]bool, len(profiles))
+	for _, profile := range profiles {
+		if seen[profile.Name] {
+			continue
+		}
+		seen[profile.Name] = true
+		req, err := ProfileRequest(profile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if isOpen(req, open) {
+			slog.Debug("tunnel profile already open", "profile", profile.Name)
+			continue
+		}
+
+		tunnel, err := c.Open(ctx, req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to start tunnel '%s': %w", profile.Name, err))
+			continue
+		}
+		slog.Info("opened tunnel profile", "profile", profile.Name, "tunnel", tunnel.ID)
+		// Another profile may describe the same tunnel
+		open = append(open, tunnel)
+	}
+	return errors.Join(errs...)
+}
+
+// isOpen reports whether any of the tunnels is what req would open
+func isOpen(req OpenRequest, tunnels []TunnelInfo) bool {
+	for _, tunnel := range tunnels {
+		if req.Matches(tunnel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mytunnel/internal/logging"
+)
+
+// Server exposes a Controller over HTTP on a Unix socket
+type Server struct {
+	controller Controller
+	logs       logging.Source
+	shutdown   chan struct{}
+}
+
+// NewServer creates a server for controller. Logs, if not nil, is served to
+// clients for their log pane.
+func NewServer(controller Controller, logs logging.Source) *Server {
+	return &Server{
+		controller: controller,
+		logs:       logs,
+		shutdown:   make(chan struct{}, 1),
+	}
+}
+
+// Serve answers requests on a listener from Listen until ctx is cancelled or
+// a client asks the daemon to stop. The listener is closed on return.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", s.handlePing)
+	mux.HandleFunc("/tunnels", s.handleTunnels)
+	mux.HandleFunc("/tunnels/", s.handleTunnel)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/logs", s.handleLogs)
+	mux.HandleFunc("/shutdown", s.handleShutdown)
+
+	// Cancelling the handlers' context ends open event streams
+	handlerCtx, cancelHandlers := context.WithCancel(ctx)
+	defer cancelHandlers()
+	server := &http.Server{
+		Handler: mux,
+		BaseContext: func(net.Listener) context.Context {
+			return handlerCtx
+		},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	slog.Info("daemon listening", "socket", listener.Addr().String())
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("daemon stopped: %w", err)
+	case <-ctx.Done():
+	case <-s.shutdown:
+	}
+
+	cancelHandlers()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	return nil
+}
+
+// Listen creates the control socket, replacing a stale one left by a daemon
+// that didn't exit cleanly. The socket file is removed when the listener is closed.
+func Listen(socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening on %s", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// handlePing answers clients checking whether the daemon is up
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int{"pid": os.Getpid()})
+}
+
+// handleTunnels lists tunnels on GET and opens one on POST
+func (s *Server) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tunnels, err := s.controller.List(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tunnels)
+	case http.MethodPost:
+		var req OpenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+		tunnel, err := s.controller.Open(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, tunnel)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleTunnel closes a tunnel on DELETE /tunnels/{id} and extends it on
+// POST /tunnels/{id}/extend
+func (s *Server) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/tunnels/")
+	id, action, _ := strings.Cut(path, "/")
+
+	switch {
+	case r.Method == http.MethodDelete && action == "":
+		if err := s.controller.Close(r.Context(), id); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "extend":
+		tunnel, err := s.controller.Extend(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tunnel)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown request %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// handleEvents streams tunnel events as JSON lines until the client goes away
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := s.controller.Events(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	encoder := json.NewEncoder(w)
+	for event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleLogs returns the daemon's recent log entries, optionally for one tunnel
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	entries := []logging.Entry{}
+	if s.logs != nil {
+		entries = append(entries, s.logs.Entries(r.URL.Query().Get("tunnel"))...)
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleShutdown stops the daemon after replying
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	select {
+	case s.shutdown <- struct{}{}:
+	default:
+	}
+}
+
+// apiError is the body of an error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// writeJSON sends v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Debug("failed to write response", "error", err)
+	}
+}
+
+// writeError sends err as a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
@@ -0,0 +1,208 @@
+// Package export renders bastions and tunnels as plain OpenSSH command lines
+// and ssh_config Host blocks, for when mytunnel itself isn't an option.
+package export
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/ssh"
+)
+
+// knownHostsFiles are the files mytunnel checks host keys against
+const knownHostsFiles = "~/.ssh/known_hosts ~/.mytunnel/known_hosts"
+
+// Format is how a bastion is exported
+type Format string
+
+const (
+	// CommandFormat is a single ssh -N command line
+	CommandFormat Format = "command"
+	// SSHConfigFormat is a set of Host blocks for ~/.ssh/config
+	SSHConfigFormat Format = "ssh-config"
+)
+
+// ParseFormat parses the name of an export format
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case CommandFormat, SSHConfigFormat:
+		return Format(name), nil
+	default:
+		return "", fmt.Errorf("invalid export format %q: must be command or ssh-config", name)
+	}
+}
+
+// Export renders a bastion and the tunnels through it in the given format
+func Export(format Format, bastion *config.BastionConfig, tunnels []daemon.TunnelInfo) string {
+	if format == SSHConfigFormat {
+		return HostBlocks(bastion, tunnels)
+	}
+	return Command(bastion, tunnels)
+}
+
+// Command renders an ssh -N command that opens the same tunnels through the
+// same route. Passwords are never included; ssh asks for them instead.
+func Command(bastion *config.BastionConfig, tunnels []daemon.TunnelInfo) string {
+	jumps := uniqueJumps(bastion)
+	var b strings.Builder
+	for _, jump := range jumps {
+		if jump.AuthType == "key" {
+			fmt.Fprintf(&b, "# -J doesn't take keys: add %s for %s to your ssh agent\n", jump.KeyPath, jump.Name)
+		}
+	}
+
+	args := []string{"ssh", "-N"}
+	if bastion.AuthType == "key" {
+		args = append(args, "-i", quote(bastion.KeyPath), "-o", "IdentitiesOnly=yes")
+	}
+	if bastion.KeepAliveInterval > 0 {
+		args = append(args, "-o", fmt.Sprintf("ServerAliveInterval=%d", int(bastion.KeepAliveInterval.Seconds())))
+	}
+	args = append(args, "-o", quote("UserKnownHostsFile="+knownHostsFiles))
+	if len(jumps) > 0 {
+		hops := make([]string, 0, len(jumps))
+		for _, jump := range jumps {
+			hop := login(jump)
+			if jump.Port != 0 && jump.Port != 22 {
+				hop += ":" + strconv.Itoa(jump.Port)
+			}
+			hops = append(hops, hop)
+		}
+		args = append(args, "-J", quote(strings.Join(hops, ",")))
+	}
+	for _, tunnel := range tunnels {
+		f := newForward(tunnel)
+		args = append(args, f.flag, quote(f.spec()))
+	}
+	if bastion.Port != 0 && bastion.Port != 22 {
+		args = append(args, "-p", strconv.Itoa(bastion.Port))
+	}
+	args = append(args, quote(login(bastion)))
+
+	b.WriteString(strings.Join(args, " "))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// HostBlocks renders ssh_config Host blocks for the bastion and every hop
+// before it, named after the bastions, so that "ssh -N <name>" opens the
+// tunnels. Passwords are never included; ssh asks for them instead.
+func HostBlocks(bastion *config.BastionConfig, tunnels []daemon.TunnelInfo) string {
+	var b strings.Builder
+	for _, jump := range uniqueJumps(bastion) {
+		writeHost(&b, jump, nil)
+		b.WriteString("\n")
+	}
+	writeHost(&b, bastion, tunnels)
+	return b.String()
+}
+
+// uniqueJumps returns the hops before a bastion, each once, so that a jump
+// host shared by several of them gets a single Host block and -J entry
+func uniqueJumps(bastion *config.BastionConfig) []*config.BastionConfig {
+	seen := make(map[string]bool, len(bastion.Jumps))
+	jumps := make([]*config.BastionConfig, 0, len(bastion.Jumps))
+	for _, jump := range bastion.Jumps {
+		if !seen[jump.Name] {
+			seen[jump.Name] = true
+			jumps = append(jumps, jump)
+		}
+	}
+	return jumps
+}
+
+// writeHost writes a single Host block
+func writeHost(b *strings.Builder, bastion *config.BastionConfig, tunnels []daemon.TunnelInfo) {
+	fmt.Fprintf(b, "Host %s\n", configQuote(bastion.Name))
+	fmt.Fprintf(b, "    HostName %s\n", bastion.Host)
+	fmt.Fprintf(b, "    User %s\n", bastion.User)
+	fmt.Fprintf(b, "    Port %d\n", bastion.Port)
+	switch bastion.AuthType {
+	case "key":
+		fmt.Fprintf(b, "    IdentityFile %s\n", configQuote(bastion.KeyPath))
+		b.WriteString("    IdentitiesOnly yes\n")
+	case "password":
+		b.WriteString("    PreferredAuthentications password,keyboard-interactive\n")
+	}
+	if len(bastion.ProxyJump) > 0 {
+		fmt.Fprintf(b, "    ProxyJump %s\n", strings.Join(bastion.ProxyJump, ","))
+	}
+	if bastion.KeepAliveInterval > 0 {
+		fmt.Fprintf(b, "    ServerAliveInterval %d\n", int(bastion.KeepAliveInterval.Seconds()))
+	}
+	fmt.Fprintf(b, "    UserKnownHostsFile %s\n", knownHostsFiles)
+	for _, tunnel := range tunnels {
+		f := newForward(tunnel)
+		if f.target == "" {
+			fmt.Fprintf(b, "    %s %s\n", f.keyword, f.listen)
+		} else {
+			fmt.Fprintf(b, "    %s %s %s\n", f.keyword, f.listen, f.target)
+		}
+	}
+}
+
+// forwardSpec is a tunnel as an ssh forwarding option
+type forwardSpec struct {
+	// flag is the ssh command line flag and keyword the ssh_config keyword
+	flag, keyword string
+	listen        string
+	// target is blank for dynamic forwards
+	target string
+}
+
+// newForward describes the forwarding option that opens a tunnel
+func newForward(tunnel daemon.TunnelInfo) forwardSpec {
+	switch tunnel.Type {
+	case ssh.RemoteTunnel:
+		return forwardSpec{"-R", "RemoteForward", strconv.Itoa(tunnel.RemotePort), hostPort("localhost", tunnel.LocalPort)}
+	case ssh.DynamicTunnel:
+		return forwardSpec{"-D", "DynamicForward", strconv.Itoa(tunnel.LocalPort), ""}
+	default:
+		host := tunnel.RemoteHost
+		if host == "" {
+			host = "localhost"
+		}
+		return forwardSpec{"-L", "LocalForward", strconv.Itoa(tunnel.LocalPort), hostPort(host, tunnel.RemotePort)}
+	}
+}
+
+// spec joins the forward into the argument of its command line flag
+func (f forwardSpec) spec() string {
+	if f.target == "" {
+		return f.listen
+	}
+	return f.listen + ":" + f.target
+}
+
+// hostPort joins a forwarding target, bracketing IPv6 addresses
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// login renders a host as user@host
+func login(bastion *config.BastionConfig) string {
+	if bastion.User == "" {
+		return bastion.Host
+	}
+	return bastion.User + "@" + bastion.Host
+}
+
+// configQuote double-quotes an ssh_config argument that contains spaces
+func configQuote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// quote single-quotes a shell word if it contains anything but safe characters
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
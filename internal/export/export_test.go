@@ -0,0 +1,63 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/ssh"
+)
+
+// sharedJumpBastion returns a bastion reached through two jumps that share
+// the same jump host, with the chain as it was resolved before dedup
+func sharedJumpBastion() *config.BastionConfig {
+	public := &config.BastionConfig{Name: "public", Host: "public.example.com", User: "ops", Port: 22, AuthType: "agent"}
+	internal := &config.BastionConfig{Name: "internal", Host: "10.0.0.2", User: "ops", Port: 2222, AuthType: "agent", ProxyJump: []string{"public"}}
+	admin := &config.BastionConfig{Name: "admin", Host: "10.0.0.3", User: "ops", Port: 22, AuthType: "agent", ProxyJump: []string{"public"}}
+	return &config.BastionConfig{
+		Name:      "db",
+		Host:      "10.0.1.5",
+		User:      "ops",
+		Port:      22,
+		AuthType:  "agent",
+		ProxyJump: []string{"internal", "admin"},
+		Jumps:     []*config.BastionConfig{public, internal, public, admin},
+	}
+}
+
+func TestExportSharedJumps(t *testing.T) {
+	bastion := sharedJumpBastion()
+	tunnels := []daemon.TunnelInfo{{Type: ssh.LocalTunnel, LocalPort: 5432, RemoteHost: "localhost", RemotePort: 5432}}
+
+	tests := []struct {
+		format Format
+		want   []string
+		// once must appear exactly once in the output
+		once []string
+	}{
+		{
+			format: CommandFormat,
+			want:   []string{"-J ops@public.example.com,ops@10.0.0.2:2222,ops@10.0.0.3", "-L 5432:localhost:5432", "ops@10.0.1.5"},
+			once:   []string{"ops@public.example.com"},
+		},
+		{
+			format: SSHConfigFormat,
+			want:   []string{"Host db\n", "    ProxyJump internal,admin\n", "    LocalForward 5432 localhost:5432\n"},
+			once:   []string{"Host public\n", "Host internal\n", "Host admin\n"},
+		},
+	}
+	for _, tt := range tests {
+		got := Export(tt.format, bastion, tunnels)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("Export(%s) is missing %q:\n%s", tt.format, want, got)
+			}
+		}
+		for _, once := range tt.once {
+			if n := strings.Count(got, once); n != 1 {
+				t.Errorf("Export(%s) has %q %d times, want once:\n%s", tt.format, once, n, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxLogSize is the size at which the log file is rotated
+	maxLogSize = 10 * 1024 * 1024
+	// maxLogBackups is how many rotated log files are kept
+	maxLogBackups = 5
+	// ringSize is how many recent entries are kept in memory for the UI
+	ringSize = 1000
+)
+
+// Setup installs the default slog logger, writing to the rotating file
+// ~/.mytunnel/logs/<name>.log and to an in-memory ring buffer that is returned
+func Setup(name string, level slog.Level) (*Ring, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	logDir := filepath.Join(home, ".mytunnel", "logs")
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	file, err := newRotatingFile(filepath.Join(logDir, name+".log"), maxLogSize, maxLogBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := NewRing(ringSize)
+	fileHandler := slog.NewTextHandler(file, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(newRingHandler(fileHandler, ring)))
+
+	return ring, nil
+}
+
+// ParseLevel parses a log level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q: must be one of debug, info, warn or error", name)
+	}
+}
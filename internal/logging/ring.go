@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TunnelKey is the attribute that ties a log entry to a tunnel
+const TunnelKey = "tunnel"
+
+// Entry is a log record kept in memory
+type Entry struct {
+	Time    time.Time  `json:"time"`
+	Level   slog.Level `json:"level"`
+	Message string     `json:"message"`
+	Tunnel  string     `json:"tunnel,omitempty"`
+	Attrs   string     `json:"attrs,omitempty"`
+}
+
+// Source provides recent log entries, optionally filtered by tunnel
+type Source interface {
+	Entries(tunnel string) []Entry
+}
+
+// Merge combines several sources into one, ordering entries by time
+func Merge(sources ...Source) Source {
+	return merged(sources)
+}
+
+// merged is the Source returned by Merge
+type merged []Source
+
+// Entries implements Source
+func (m merged) Entries(tunnel string) []Entry {
+	var entries []Entry
+	for _, source := range m {
+		entries = append(entries, source.Entries(tunnel)...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
+
+// String formats the entry as a single line
+func (e Entry) String() string {
+	line := fmt.Sprintf("%s %-5s %s", e.Time.Format("15:04:05"), e.Level, e.Message)
+	if e.Tunnel != "" {
+		line += " " + TunnelKey + "=" + e.Tunnel
+	}
+	if e.Attrs != "" {
+		line += " " + e.Attrs
+	}
+	return line
+}
+
+// Ring keeps the most recent log entries
+type Ring struct {
+	entries []Entry
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+// NewRing creates a ring buffer holding up to size entries
+func NewRing(size int) *Ring {
+	return &Ring{entries: make([]Entry, size)}
+}
+
+// add stores an entry, overwriting the oldest one when full
+func (r *Ring) add(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Entries returns the stored entries oldest first. A non-empty tunnel keeps
+// only the entries logged for that tunnel.
+func (r *Ring) Entries(tunnel string) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ordered []Entry
+	if r.full {
+		ordered = append(ordered, r.entries[r.next:]...)
+	}
+	ordered = append(ordered, r.entries[:r.next]...)
+
+	if tunnel == "" {
+		return ordered
+	}
+	filtered := ordered[:0]
+	for _, entry := range ordered {
+		if entry.Tunnel == tunnel {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// ringHandler is a slog.Handler that copies records into a Ring before
+// passing them on
+type ringHandler struct {
+	next  slog.Handler
+	ring  *Ring
+	attrs []slog.Attr
+}
+
+// newRingHandler wraps next so that its records are also kept in ring
+func newRingHandler(next slog.Handler, ring *Ring) *ringHandler {
+	return &ringHandler{next: next, ring: ring}
+}
+
+// Enabled implements slog.Handler
+func (h *ringHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *ringHandler) Handle(ctx context.Context, record slog.Record) error {
+	entry := Entry{
+		Time:    record.Time,
+		Level:   record.Level,
+		Message: record.Message,
+	}
+
+	var attrs []string
+	collect := func(attr slog.Attr) bool {
+		if attr.Key == TunnelKey {
+			entry.Tunnel = attr.Value.String()
+		} else {
+			attrs = append(attrs, attr.String())
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		collect(attr)
+	}
+	record.Attrs(collect)
+	entry.Attrs = strings.Join(attrs, " ")
+
+	h.ring.add(entry)
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *ringHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ringHandler{
+		next:  h.next.WithAttrs(attrs),
+		ring:  h.ring,
+		attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
+	}
+}
+
+// WithGroup implements slog.Handler
+func (h *ringHandler) WithGroup(name string) slog.Handler {
+	return &ringHandler{
+		next:  h.next.WithGroup(name),
+		ring:  h.ring,
+		attrs: h.attrs,
+	}
+}
@@ -0,0 +1,143 @@
+package ssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"mytunnel/internal/config"
+)
+
+// clientConfig builds the SSH client configuration for a bastion.
+// The returned cleanup function releases resources held for authentication
+// and must be called once the handshake has finished.
+func clientConfig(bastion *config.BastionConfig, hostKeys *HostKeyVerifier) (*ssh.ClientConfig, func(), error) {
+	config := &ssh.ClientConfig{
+		User:            bastion.User,
+		HostKeyCallback: hostKeys.Check,
+		Timeout:         time.Second * 10,
+	}
+	cleanup := func() {}
+
+	// Set up authentication
+	switch bastion.AuthType {
+	case "key":
+		key, err := ioutil.ReadFile(bastion.KeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	case "agent":
+		conn, signers, err := agentSigners()
+		if err != nil {
+			return nil, nil, err
+		}
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+		cleanup = func() { conn.Close() }
+	default:
+		config.Auth = []ssh.AuthMethod{ssh.Password(bastion.Password)}
+	}
+
+	return config, cleanup, nil
+}
+
+// agentSigners connects to the SSH agent on SSH_AUTH_SOCK and returns its identities
+func agentSigners() (net.Conn, []ssh.Signer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("SSH_AUTH_SOCK is not set, is an ssh agent running?")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh agent: %w", err)
+	}
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to list ssh agent identities: %w", err)
+	}
+	if len(signers) == 0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("ssh agent has no identities, add one with ssh-add")
+	}
+
+	return conn, signers, nil
+}
+
+// dialBastion opens an authenticated SSH connection to a bastion, hopping
+// through its ProxyJump chain first. Closing the returned client also closes
+// the connections to the jump hosts.
+func dialBastion(bastion *config.BastionConfig, hostKeys *HostKeyVerifier) (*ssh.Client, error) {
+	var client *ssh.Client
+	hops := append(append([]*config.BastionConfig{}, bastion.Jumps...), bastion)
+
+	for _, hop := range hops {
+		next, err := dialHop(client, hop, hostKeys)
+		if err != nil {
+			if client != nil {
+				client.Close()
+			}
+			if len(hops) > 1 {
+				return nil, fmt.Errorf("hop '%s': %w", hop.Name, err)
+			}
+			return nil, err
+		}
+
+		// Tear down the previous hop once the connection tunneled through it ends
+		if client != nil {
+			prev := client
+			go func() {
+				next.Wait()
+				prev.Close()
+			}()
+		}
+		client = next
+	}
+
+	return client, nil
+}
+
+// dialHop connects to a single bastion, directly or through the previous hop
+func dialHop(via *ssh.Client, bastion *config.BastionConfig, hostKeys *HostKeyVerifier) (*ssh.Client, error) {
+	config, cleanup, err := clientConfig(bastion, hostKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	addr := net.JoinHostPort(bastion.Host, strconv.Itoa(bastion.Port))
+
+	var conn net.Conn
+	if via == nil {
+		conn, err = net.DialTimeout("tcp", addr, config.Timeout)
+	} else {
+		conn, err = via.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bastion: %w", err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if bastion.AuthType == "agent" && strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, fmt.Errorf("none of the ssh agent identities are accepted by %s@%s: %w",
+				bastion.User, bastion.Host, err)
+		}
+		return nil, fmt.Errorf("failed to connect to bastion: %w", err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,101 @@
+package ssh
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// copyBufferSize is the size of the buffers used to copy tunnel traffic
+const copyBufferSize = 32 * 1024
+
+// copyBuffers recycles copy buffers across connections
+var copyBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, copyBufferSize)
+		return &buffer
+	},
+}
+
+// closeWriter is implemented by connections that can be half-closed, such as
+// *net.TCPConn and the ssh.Channel behind connections opened through a bastion
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// bridge copies data bidirectionally between two connections, counting the traffic
+func (t *Tunnel) bridge(local, remote net.Conn) {
+	t.activeConns.Add(1)
+	peer := local.RemoteAddr().String()
+	if t.Type == RemoteTunnel {
+		peer = remote.RemoteAddr().String()
+	}
+
+	go func() {
+		t.pipe(local, remote)
+		if t.activeConns.Add(-1) == 0 {
+			t.idleSince.Store(time.Now().UnixNano())
+		}
+		t.emit(Event{Type: EventConnectionClosed, Peer: peer})
+	}()
+}
+
+// pipe copies in both directions and returns once both copies have finished
+// and both connections are closed. EOF in one direction is passed on as a
+// half-close, so the other direction keeps flowing until it ends as well.
+func (t *Tunnel) pipe(local, remote net.Conn) {
+	outbound := make(chan struct{})
+	go func() {
+		defer close(outbound)
+		t.copyData(remote, local, &t.bytesOut)
+	}()
+
+	t.copyData(local, remote, &t.bytesIn)
+	<-outbound
+
+	local.Close()
+	remote.Close()
+}
+
+// copyData copies from src to dst, adding the bytes written to counter. EOF
+// on src half-closes dst; any other failure closes both connections so that
+// the copy in the opposite direction stops too.
+func (t *Tunnel) copyData(dst, src net.Conn, counter *atomic.Int64) {
+	buffer := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buffer)
+
+	for {
+		n, err := src.Read(*buffer)
+		if n > 0 {
+			written, writeErr := dst.Write((*buffer)[:n])
+			counter.Add(int64(written))
+			t.touch()
+			if writeErr != nil {
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			if closeWrite(dst) == nil {
+				return
+			}
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	dst.Close()
+	src.Close()
+}
+
+// closeWrite half-closes conn, or closes it if it can't be half-closed
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return conn.Close()
+}
@@ -0,0 +1,369 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"mytunnel/internal/config"
+)
+
+// startTestBastion runs an in-process SSH server that accepts any password and
+// serves direct-tcpip channels, propagating half-closes like OpenSSH does
+func startTestBastion(tb testing.TB) *config.BastionConfig {
+	tb.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(conn, serverConfig)
+		}
+	}()
+
+	return &config.BastionConfig{
+		Name:     "test",
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		User:     "test",
+		AuthType: "password",
+		Password: "test",
+	}
+}
+
+// serveTestConn handles one SSH connection to the test bastion
+func serveTestConn(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			remote.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			io.Copy(channel, remote)
+			channel.CloseWrite()
+		}()
+		go func() {
+			io.Copy(remote, channel)
+			remote.(*net.TCPConn).CloseWrite()
+		}()
+	}
+}
+
+// newTestManager returns a tunnel manager that trusts any host key
+func newTestManager(tb testing.TB) *TunnelManager {
+	tb.Helper()
+
+	tm := NewTunnelManager()
+	trustFile := filepath.Join(tb.TempDir(), "known_hosts")
+	tm.hostKeys = &HostKeyVerifier{
+		files:     []string{trustFile},
+		trustFile: trustFile,
+		prompt:    func(string, string, string) bool { return true },
+	}
+	tb.Cleanup(tm.CloseAll)
+	return tm
+}
+
+// startTestServer runs a TCP server that hands each connection to handle
+func startTestServer(tb testing.TB, handle func(*net.TCPConn)) int {
+	tb.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn.(*net.TCPConn))
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// freePort returns a local port that is free at the time of the call
+func freePort(tb testing.TB) int {
+	tb.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// openTestTunnel forwards a free local port to targetPort through bastion
+func openTestTunnel(tb testing.TB, tm *TunnelManager, bastion *config.BastionConfig, targetPort int) (*Tunnel, int) {
+	tb.Helper()
+
+	localPort := freePort(tb)
+	if err := tm.CreateTunnel(localPort, "127.0.0.1", targetPort, bastion); err != nil {
+		tb.Fatal(err)
+	}
+	for _, tunnel := range tm.ListTunnels() {
+		if tunnel.LocalPort == localPort {
+			return tunnel, localPort
+		}
+	}
+	tb.Fatal("tunnel not listed")
+	return nil, 0
+}
+
+// waitIdle waits for every connection through the tunnel to be torn down
+func waitIdle(t *testing.T, tunnel *Tunnel) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tunnel.Stats().ActiveConns != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections still active", tunnel.Stats().ActiveConns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTunnelHalfClose(t *testing.T) {
+	// The server only answers once the client has finished sending
+	targetPort := startTestServer(t, func(conn *net.TCPConn) {
+		request, err := io.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(conn, "received %d bytes", len(request))
+	})
+
+	tm := newTestManager(t)
+	tunnel, localPort := openTestTunnel(t, tm, startTestBastion(t), targetPort)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	request := bytes.Repeat([]byte("x"), 1<<20)
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("received %d bytes", len(request)); string(response) != want {
+		t.Fatalf("got response %q, want %q", response, want)
+	}
+
+	conn.Close()
+	waitIdle(t, tunnel)
+	if stats := tunnel.Stats(); stats.BytesOut != int64(len(request)) || stats.BytesIn != int64(len(response)) {
+		t.Fatalf("got %d bytes out and %d in, want %d and %d", stats.BytesOut, stats.BytesIn, len(request), len(response))
+	}
+}
+
+func TestTunnelServerHalfClose(t *testing.T) {
+	// The server sends a greeting and stops writing, but keeps reading
+	targetPort := startTestServer(t, func(conn *net.TCPConn) {
+		conn.Write([]byte("hello"))
+		conn.CloseWrite()
+		io.Copy(io.Discard, conn)
+	})
+
+	tm := newTestManager(t)
+	tunnel, localPort := openTestTunnel(t, tm, startTestBastion(t), targetPort)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	greeting, err := io.ReadAll(conn)
+	if err != nil || string(greeting) != "hello" {
+		t.Fatalf("got greeting %q, %v", greeting, err)
+	}
+
+	// The client can still write after the server's EOF
+	if _, err := conn.Write([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if tunnel.Stats().ActiveConns != 1 {
+		t.Fatal("connection torn down after the server half-closed")
+	}
+
+	conn.Close()
+	waitIdle(t, tunnel)
+}
+
+func TestTunnelConnectionsTornDown(t *testing.T) {
+	// The server hangs up without reading anything
+	targetPort := startTestServer(t, func(conn *net.TCPConn) {})
+
+	tm := newTestManager(t)
+	tunnel, localPort := openTestTunnel(t, tm, startTestBastion(t), targetPort)
+
+	for i := 0; i < 20; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadAll(conn); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	waitIdle(t, tunnel)
+
+	if stats := tunnel.Stats(); stats.TotalConns != 20 {
+		t.Fatalf("got %d connections, want 20", stats.TotalConns)
+	}
+}
+
+// BenchmarkTunnelThroughput measures bulk transfer through a local tunnel
+func BenchmarkTunnelThroughput(b *testing.B) {
+	targetPort := startTestServer(b, func(conn *net.TCPConn) {
+		io.Copy(io.Discard, conn)
+		conn.Write([]byte("done"))
+	})
+
+	tm := newTestManager(b)
+	_, localPort := openTestTunnel(b, tm, startTestBastion(b), targetPort)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	chunk := make([]byte, copyBufferSize)
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	if _, err := io.ReadAll(conn); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkPipe measures the copy loop alone between two loopback connections
+func BenchmarkPipe(b *testing.B) {
+	sinkPort := startTestServer(b, func(conn *net.TCPConn) {
+		io.Copy(io.Discard, conn)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+
+	tunnel := &Tunnel{events: newEventBus()}
+	go func() {
+		local, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		remote, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", sinkPort))
+		if err != nil {
+			local.Close()
+			return
+		}
+		tunnel.pipe(local, remote)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	chunk := make([]byte, copyBufferSize)
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
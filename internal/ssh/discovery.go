@@ -0,0 +1,296 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"mytunnel/internal/config"
+)
+
+// ListeningPort describes a TCP socket listening on the bastion
+type ListeningPort struct {
+	Address string
+	Port    int
+}
+
+// portProbe is a remote command that lists listening sockets and its output parser
+type portProbe struct {
+	command string
+	parse   func([]byte) []ListeningPort
+}
+
+// portProbes are tried in order until one of them succeeds on the bastion
+var portProbes = []portProbe{
+	{command: "ss -Hltn", parse: parseSS},
+	{command: "netstat -ltn", parse: parseNetstat},
+	// cat fails on hosts without IPv6, where /proc/net/tcp6 doesn't exist
+	{command: "cat /proc/net/tcp /proc/net/tcp6 2>/dev/null; true", parse: parseProcNetTCP},
+}
+
+// PortDiscovery periodically lists the listening TCP ports on a bastion
+type PortDiscovery struct {
+	manager  *TunnelManager
+	bastion  *config.BastionConfig
+	interval time.Duration
+	client   *ssh.Client
+	probe    *portProbe
+	mu       sync.Mutex
+	// ctx is cancelled by Stop and bounds every dial
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPortDiscovery creates a port discovery for the given bastion
+func NewPortDiscovery(manager *TunnelManager, bastion *config.BastionConfig, interval time.Duration) *PortDiscovery {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PortDiscovery{
+		manager:  manager,
+		bastion:  bastion,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start runs discovery immediately and then on every interval until Stop is called
+func (d *PortDiscovery) Start(onUpdate func([]ListeningPort, error)) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			ports, err := d.Discover()
+			if d.ctx.Err() != nil {
+				return
+			}
+			onUpdate(ports, err)
+
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic discovery and closes the SSH connection. It
+// returns right away, even while a dial or probe is in progress; the
+// connection is released once that finishes.
+func (d *PortDiscovery) Stop() {
+	d.cancel()
+	go func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.client != nil {
+			d.manager.releaseClient(d.client)
+			d.client = nil
+		}
+	}()
+}
+
+// Discover lists the TCP ports currently listening on the bastion
+func (d *PortDiscovery) Discover() ([]ListeningPort, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Once stopped, never take a connection that nothing would release
+	if err := d.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if d.client == nil {
+		client, err := d.manager.acquireClient(d.ctx, d.bastion)
+		if err != nil {
+			return nil, err
+		}
+		d.client = client
+	}
+
+	// Reuse the probe that worked last time
+	if d.probe != nil {
+		ports, err := d.run(d.probe)
+		if err == nil {
+			return ports, nil
+		}
+		if d.client == nil {
+			return nil, err
+		}
+		d.probe = nil
+	}
+
+	var lastErr error
+	for i := range portProbes {
+		probe := &portProbes[i]
+		ports, err := d.run(probe)
+		if err != nil {
+			if d.client == nil {
+				// The connection was dropped, the other probes can't run either
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		d.probe = probe
+		return ports, nil
+	}
+	return nil, fmt.Errorf("failed to list listening ports: %w", lastErr)
+}
+
+// run executes a probe in a new session on the bastion
+func (d *PortDiscovery) run(probe *portProbe) ([]ListeningPort, error) {
+	session, err := d.client.NewSession()
+	if err != nil {
+		// The connection is likely dead, redial on the next attempt
+		d.manager.pool.discard(d.client)
+		d.client = nil
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.Output(probe.command)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", probe.command, err)
+	}
+
+	ports := probe.parse(output)
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("%s: no listening ports found", probe.command)
+	}
+	return sortPorts(ports), nil
+}
+
+// sortPorts removes duplicates and orders ports by number, then by address
+func sortPorts(ports []ListeningPort) []ListeningPort {
+	seen := make(map[ListeningPort]bool, len(ports))
+	unique := make([]ListeningPort, 0, len(ports))
+	for _, p := range ports {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		unique = append(unique, p)
+	}
+
+	sort.Slice(unique, func(i, j int) bool {
+		if unique[i].Port != unique[j].Port {
+			return unique[i].Port < unique[j].Port
+		}
+		return unique[i].Address < unique[j].Address
+	})
+	return unique
+}
+
+// parseSS parses the output of `ss -Hltn`
+func parseSS(output []byte) []ListeningPort {
+	var ports []ListeningPort
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// State Recv-Q Send-Q Local-Address:Port Peer-Address:Port
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "LISTEN" {
+			continue
+		}
+		if port, ok := parseSocketAddress(fields[3]); ok {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// parseNetstat parses the output of `netstat -ltn`
+func parseNetstat(output []byte) []ListeningPort {
+	var ports []ListeningPort
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// Proto Recv-Q Send-Q Local-Address Foreign-Address State
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.HasPrefix(fields[0], "tcp") || fields[5] != "LISTEN" {
+			continue
+		}
+		if port, ok := parseSocketAddress(fields[3]); ok {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// parseSocketAddress splits addresses such as 0.0.0.0:22, [::1]:631, :::80 or 127.0.0.53%lo:53
+func parseSocketAddress(addr string) (ListeningPort, bool) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return ListeningPort{}, false
+	}
+
+	port, err := strconv.Atoi(addr[i+1:])
+	if err != nil {
+		return ListeningPort{}, false
+	}
+
+	host := strings.Trim(addr[:i], "[]")
+	if j := strings.Index(host, "%"); j >= 0 {
+		host = host[:j]
+	}
+	if host == "" {
+		host = "::"
+	}
+	return ListeningPort{Address: host, Port: port}, true
+}
+
+// tcpListenState is the socket state for LISTEN in /proc/net/tcp
+const tcpListenState = "0A"
+
+// parseProcNetTCP parses the contents of /proc/net/tcp and /proc/net/tcp6
+func parseProcNetTCP(output []byte) []ListeningPort {
+	var ports []ListeningPort
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != tcpListenState {
+			continue
+		}
+
+		parts := strings.Split(fields[1], ":")
+		if len(parts) != 2 {
+			continue
+		}
+		ip, err := parseProcIP(parts[0])
+		if err != nil {
+			continue
+		}
+		port, err := strconv.ParseUint(parts[1], 16, 16)
+		if err != nil {
+			continue
+		}
+		ports = append(ports, ListeningPort{Address: ip.String(), Port: int(port)})
+	}
+	return ports
+}
+
+// parseProcIP decodes a hex address from /proc/net/tcp, stored as host-order 32-bit words
+func parseProcIP(s string) (net.IP, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return nil, fmt.Errorf("invalid address length %d", len(raw))
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return ip, nil
+}
@@ -0,0 +1,145 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSS(t *testing.T) {
+	output := `LISTEN 0      4096   127.0.0.53%lo:53         0.0.0.0:*
+LISTEN 0      128          0.0.0.0:22         0.0.0.0:*
+LISTEN 0      244        127.0.0.1:5432       0.0.0.0:*
+LISTEN 0      128             [::]:22            [::]:*
+LISTEN 0      511                *:80               *:*
+LISTEN 0      4096           [::1]:631           [::]:*
+ESTAB  0      0          10.0.0.5:22     10.0.0.9:51234
+`
+	want := []ListeningPort{
+		{Address: "127.0.0.53", Port: 53},
+		{Address: "0.0.0.0", Port: 22},
+		{Address: "127.0.0.1", Port: 5432},
+		{Address: "::", Port: 22},
+		{Address: "*", Port: 80},
+		{Address: "::1", Port: 631},
+	}
+	if got := parseSS([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSS() = %v, want %v", got, want)
+	}
+}
+
+func TestParseNetstat(t *testing.T) {
+	output := `Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State
+tcp        0      0 0.0.0.0:22              0.0.0.0:*               LISTEN
+tcp        0      0 127.0.0.1:6379          0.0.0.0:*               LISTEN
+tcp6       0      0 :::80                   :::*                    LISTEN
+tcp6       0      0 ::1:631                 :::*                    LISTEN
+udp        0      0 0.0.0.0:68              0.0.0.0:*
+`
+	want := []ListeningPort{
+		{Address: "0.0.0.0", Port: 22},
+		{Address: "127.0.0.1", Port: 6379},
+		{Address: "::", Port: 80},
+		{Address: "::1", Port: 631},
+	}
+	if got := parseNetstat([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetstat() = %v, want %v", got, want)
+	}
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want ListeningPort
+		ok   bool
+	}{
+		{"0.0.0.0:22", ListeningPort{"0.0.0.0", 22}, true},
+		{"[::1]:631", ListeningPort{"::1", 631}, true},
+		{":::80", ListeningPort{"::", 80}, true},
+		{"127.0.0.53%lo:53", ListeningPort{"127.0.0.53", 53}, true},
+		{"[fe80::1%eth0]:8080", ListeningPort{"fe80::1", 8080}, true},
+		{"0.0.0.0:*", ListeningPort{}, false},
+		{"localhost", ListeningPort{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSocketAddress(tt.addr)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseSocketAddress(%q) = %v, %v, want %v, %v", tt.addr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseProcNetTCP(t *testing.T) {
+	// /proc/net/tcp followed by /proc/net/tcp6, as cat prints them
+	output := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20341 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000   113        0 23871 1 0000000000000000 100 0 0 10 0
+   2: 0500000A:0016 0900000A:C822 01 00000000:00000000 02:000A7B1E 00000000     0        0 61234 2 0000000000000000 20 4 29 10 -1
+  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20343 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 18012 1 0000000000000000 100 0 0 10 0
+`
+	want := []ListeningPort{
+		{Address: "0.0.0.0", Port: 22},
+		{Address: "127.0.0.1", Port: 5432},
+		{Address: "::", Port: 80},
+		{Address: "::1", Port: 631},
+	}
+	if got := parseProcNetTCP([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNetTCP() = %v, want %v", got, want)
+	}
+}
+
+func TestParseProcNetTCPIPv4Only(t *testing.T) {
+	// Hosts without IPv6 have no /proc/net/tcp6
+	output := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20341 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   113        0 23871 1 0000000000000000 100 0 0 10 0
+`
+	want := []ListeningPort{
+		{Address: "0.0.0.0", Port: 22},
+		{Address: "127.0.0.1", Port: 3306},
+	}
+	if got := parseProcNetTCP([]byte(output)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNetTCP() = %v, want %v", got, want)
+	}
+}
+
+func TestParseProcIP(t *testing.T) {
+	tests := []struct {
+		hex     string
+		want    string
+		wantErr bool
+	}{
+		{"0100007F", "127.0.0.1", false},
+		{"0500000A", "10.0.0.5", false},
+		{"00000000", "0.0.0.0", false},
+		{"00000000000000000000000001000000", "::1", false},
+		{"B80D01200000000000000000010000FE", "2001:db8::fe00:1", false},
+		{"0000000000000000FFFF00000100007F", "127.0.0.1", false},
+		{"0100", "", true},
+		{"zz00007F", "", true},
+	}
+	for _, tt := range tests {
+		ip, err := parseProcIP(tt.hex)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseProcIP(%q) error = %v, wantErr %v", tt.hex, err, tt.wantErr)
+			continue
+		}
+		if err == nil && ip.String() != tt.want {
+			t.Errorf("parseProcIP(%q) = %s, want %s", tt.hex, ip, tt.want)
+		}
+	}
+}
+
+func TestSortPorts(t *testing.T) {
+	ports := []ListeningPort{
+		{"::", 22}, {"0.0.0.0", 5432}, {"0.0.0.0", 22}, {"::", 22},
+	}
+	want := []ListeningPort{
+		{"0.0.0.0", 22}, {"::", 22}, {"0.0.0.0", 5432},
+	}
+	if got := sortPorts(ports); !reflect.DeepEqual(got, want) {
+		t.Errorf("sortPorts() = %v, want %v", got, want)
+	}
+}
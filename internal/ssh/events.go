@@ -0,0 +1,189 @@
+package ssh
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"mytunnel/internal/logging"
+)
+
+// EventType is the kind of a tunnel lifecycle event
+type EventType int
+
+const (
+	// EventCreated is sent when a tunnel is added to the manager
+	EventCreated EventType = iota
+	// EventConnected is sent when a tunnel's bastion connection is (re)established
+	EventConnected
+	// EventConnectionAccepted is sent for every connection accepted by a tunnel
+	EventConnectionAccepted
+	// EventConnectionClosed is sent when a forwarded connection ends
+	EventConnectionClosed
+	// EventError is sent when something fails without closing the tunnel
+	EventError
+	// EventReconnecting is sent before every attempt to restore a lost connection
+	EventReconnecting
+	// EventExpired is sent when a tunnel reaches its idle timeout or max lifetime
+	EventExpired
+	// EventClosed is sent when a tunnel is removed from the manager
+	EventClosed
+)
+
+// String returns the name of the event type
+func (e EventType) String() string {
+	switch e {
+	case EventCreated:
+		return "created"
+	case EventConnected:
+		return "connected"
+	case EventConnectionAccepted:
+		return "connection accepted"
+	case EventConnectionClosed:
+		return "connection closed"
+	case EventError:
+		return "error"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventExpired:
+		return "expired"
+	case EventClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the event type by name
+func (e EventType) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText decodes an event type name
+func (e *EventType) UnmarshalText(text []byte) error {
+	for event := EventCreated; event <= EventClosed; event++ {
+		if event.String() == string(text) {
+			*e = event
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid event type %q", text)
+}
+
+// Event describes something that happened to a tunnel
+type Event struct {
+	Type   EventType
+	Tunnel *Tunnel
+	Time   time.Time
+	// Message describes what failed for EventError, or why EventExpired fired
+	Message string
+	Err     error
+	// Attempt is the reconnect attempt for EventReconnecting and EventConnected
+	Attempt int
+	// Peer is the address of the forwarded connection's client
+	Peer string
+}
+
+// eventBufferSize is how many events a subscriber may fall behind before
+// further events are dropped for it
+const eventBufferSize = 256
+
+// eventBus fans tunnel events out to subscribers
+type eventBus struct {
+	subscribers map[int]chan Event
+	next        int
+	mu          sync.Mutex
+}
+
+// newEventBus creates an event bus without subscribers
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[int]chan Event)}
+}
+
+// subscribe registers a new subscriber
+func (b *eventBus) subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	ch := make(chan Event, eventBufferSize)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// publish sends an event to every subscriber without blocking on slow ones
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every tunnel event and a function that
+// cancels the subscription and closes the channel. Events are dropped for a
+// subscriber that falls too far behind, so consumers should not block.
+func (tm *TunnelManager) Subscribe() (<-chan Event, func()) {
+	return tm.events.subscribe()
+}
+
+// emit publishes an event for the tunnel
+func (t *Tunnel) emit(event Event) {
+	if t.events == nil {
+		return
+	}
+	event.Tunnel = t
+	event.Time = time.Now()
+	t.events.publish(event)
+}
+
+// logEvents writes tunnel events to the log until the channel is closed
+func logEvents(events <-chan Event) {
+	for event := range events {
+		logger := slog.Default().With(logging.TunnelKey, event.Tunnel.ID())
+		switch event.Type {
+		case EventCreated:
+			attrs := []any{"type", event.Tunnel.Type.String(), "bastion", event.Tunnel.Bastion.RouteString()}
+			switch event.Tunnel.Type {
+			case LocalTunnel:
+				attrs = append(attrs, "target", event.Tunnel.RemoteAddr())
+			case RemoteTunnel:
+				attrs = append(attrs, "local_port", event.Tunnel.LocalPort)
+			}
+			logger.Info("tunnel created", attrs...)
+		case EventConnected:
+			if event.Attempt > 0 {
+				logger.Info("reconnected", "attempts", event.Attempt)
+			} else {
+				logger.Debug("connected")
+			}
+		case EventConnectionAccepted:
+			logger.Debug("connection accepted", "peer", event.Peer)
+		case EventConnectionClosed:
+			logger.Debug("connection closed", "peer", event.Peer)
+		case EventError:
+			logger.Warn(event.Message, "error", event.Err)
+		case EventReconnecting:
+			logger.Warn("reconnecting", "attempt", event.Attempt, "error", event.Err)
+		case EventExpired:
+			logger.Info("tunnel expired", "reason", event.Message)
+		case EventClosed:
+			logger.Info("tunnel closed")
+		}
+	}
+}
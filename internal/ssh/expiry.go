@@ -0,0 +1,110 @@
+package ssh
+
+import (
+	"fmt"
+	"time"
+)
+
+// expiryCheckInterval is how often a tunnel is checked against its limits
+const expiryCheckInterval = time.Second
+
+// TunnelLimits bounds how long a tunnel stays open. A zero value disables a limit.
+type TunnelLimits struct {
+	// IdleTimeout closes the tunnel after this long without connections
+	IdleTimeout time.Duration `json:"idle_timeout"`
+	// MaxLifetime closes the tunnel this long after it was opened or extended
+	MaxLifetime time.Duration `json:"max_lifetime"`
+}
+
+// Expiry is the next time a tunnel will be closed by one of its limits
+type Expiry struct {
+	At time.Time
+	// Reason is "idle" or "lifetime"
+	Reason string
+}
+
+// Limits returns the tunnel's idle timeout and max lifetime
+func (t *Tunnel) Limits() TunnelLimits {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits
+}
+
+// SetLimits replaces the limits inherited from the bastion
+func (t *Tunnel) SetLimits(limits TunnelLimits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+}
+
+// Extend restarts the tunnel's idle and lifetime clocks, pushing its expiry back
+func (t *Tunnel) Extend() {
+	now := time.Now()
+	t.mu.Lock()
+	t.openedAt = now
+	t.mu.Unlock()
+	t.idleSince.Store(now.UnixNano())
+}
+
+// Expiry returns when the tunnel will be closed, or false if no limit applies
+func (t *Tunnel) Expiry() (Expiry, bool) {
+	t.mu.Lock()
+	limits, openedAt := t.limits, t.openedAt
+	t.mu.Unlock()
+
+	var next Expiry
+	if limits.MaxLifetime > 0 {
+		next = Expiry{At: openedAt.Add(limits.MaxLifetime), Reason: "lifetime"}
+	}
+	// Open connections keep a tunnel from going idle
+	if limits.IdleTimeout > 0 && t.activeConns.Load() == 0 {
+		idle := time.Unix(0, t.idleSince.Load()).Add(limits.IdleTimeout)
+		if next.At.IsZero() || idle.Before(next.At) {
+			next = Expiry{At: idle, Reason: "idle"}
+		}
+	}
+	return next, !next.At.IsZero()
+}
+
+// enforceLimits closes the tunnel once it expires
+func (tm *TunnelManager) enforceLimits(t *Tunnel) {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+
+		if expiry, ok := t.Expiry(); ok && !time.Now().Before(expiry.At) {
+			tm.expire(t, expiry)
+			return
+		}
+	}
+}
+
+// expire closes a tunnel that reached one of its limits
+func (tm *TunnelManager) expire(t *Tunnel, expiry Expiry) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tunnels, port := tm.tunnels, t.LocalPort
+	if t.Type == RemoteTunnel {
+		tunnels, port = tm.reverse, t.RemotePort
+	}
+	if tunnels[port] != t {
+		return
+	}
+
+	limits := t.Limits()
+	message := fmt.Sprintf("reached its max lifetime of %s", limits.MaxLifetime)
+	if expiry.Reason == "idle" {
+		message = fmt.Sprintf("idle for %s", limits.IdleTimeout)
+	}
+	t.emit(Event{Type: EventExpired, Message: message})
+
+	tm.stopTunnel(t)
+	delete(tunnels, port)
+}
@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPrompt asks the user whether to trust a host key seen for the first time
+type HostKeyPrompt func(hostname, keyType, fingerprint string) bool
+
+// HostKeyVerifier checks bastion host keys against known_hosts files and
+// records keys the user accepts on first use
+type HostKeyVerifier struct {
+	files     []string
+	trustFile string
+	prompt    HostKeyPrompt
+	mu        sync.Mutex
+}
+
+// NewHostKeyVerifier creates a verifier that reads ~/.ssh/known_hosts and
+// ~/.mytunnel/known_hosts, and writes accepted keys to the latter
+func NewHostKeyVerifier() *HostKeyVerifier {
+	v := &HostKeyVerifier{}
+	if home, err := os.UserHomeDir(); err == nil {
+		v.trustFile = filepath.Join(home, ".mytunnel", "known_hosts")
+		v.files = []string{filepath.Join(home, ".ssh", "known_hosts"), v.trustFile}
+	}
+	return v
+}
+
+// SetPrompt sets the function used to confirm unknown host keys.
+// Without a prompt, unknown host keys are rejected.
+func (v *HostKeyVerifier) SetPrompt(prompt HostKeyPrompt) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.prompt = prompt
+}
+
+// Check implements ssh.HostKeyCallback
+func (v *HostKeyVerifier) Check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	// Serialize checks so concurrent dials to a new host only prompt once
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	err := v.lookup(hostname, remote, key)
+	if err == nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	if len(keyErr.Want) > 0 {
+		known := keyErr.Want[0]
+		return fmt.Errorf("host key for %s has changed (got %s %s, expected key from %s:%d); "+
+			"this could be a man-in-the-middle attack, remove the old key if the change is legitimate",
+			hostname, key.Type(), fingerprint, known.Filename, known.Line)
+	}
+
+	if v.prompt == nil {
+		return fmt.Errorf("unknown host key for %s (%s %s)", hostname, key.Type(), fingerprint)
+	}
+	if !v.prompt(hostname, key.Type(), fingerprint) {
+		return fmt.Errorf("host key for %s was rejected", hostname)
+	}
+
+	slog.Info("trusting new host key", "host", hostname, "type", key.Type(), "fingerprint", fingerprint)
+	return v.trust(hostname, key)
+}
+
+// lookup checks the key against every known_hosts file that exists
+func (v *HostKeyVerifier) lookup(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	var files []string
+	for _, file := range v.files {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return &knownhosts.KeyError{}
+	}
+
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	return callback(hostname, remote, key)
+}
+
+// trust appends an accepted host key to the mytunnel known_hosts file
+func (v *HostKeyVerifier) trust(hostname string, key ssh.PublicKey) error {
+	if v.trustFile == "" {
+		return fmt.Errorf("no known_hosts file to record host key for %s", hostname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.trustFile), 0700); err != nil {
+		return fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+
+	f, err := os.OpenFile(v.trustFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts: %w", err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"mytunnel/internal/config"
+)
+
+// pooledClient is an SSH connection shared by every tunnel on one bastion
+type pooledClient struct {
+	client *ssh.Client
+	err    error
+	refs   int
+	ready  chan struct{}
+}
+
+// clientPool keeps one reference-counted SSH connection per bastion
+type clientPool struct {
+	dial    func(*config.BastionConfig) (*ssh.Client, error)
+	clients map[string]*pooledClient
+	mu      sync.Mutex
+}
+
+// newClientPool creates a pool that opens connections with dial
+func newClientPool(dial func(*config.BastionConfig) (*ssh.Client, error)) *clientPool {
+	return &clientPool{
+		dial:    dial,
+		clients: make(map[string]*pooledClient),
+	}
+}
+
+// bastionKey identifies the connection used for a bastion, including its jump hosts
+func bastionKey(bastion *config.BastionConfig) string {
+	hops := make([]string, 0, len(bastion.Jumps)+1)
+	for _, hop := range append(append([]*config.BastionConfig{}, bastion.Jumps...), bastion) {
+		hops = append(hops, fmt.Sprintf("%s@%s:%d", hop.User, hop.Host, hop.Port))
+	}
+	return strings.Join(hops, ",")
+}
+
+// acquire returns the shared connection for a bastion, dialing it if needed.
+// Every successful acquire must be paired with a release. Cancelling ctx
+// stops the wait but not the dial, which other callers may be sharing.
+func (p *clientPool) acquire(ctx context.Context, bastion *config.BastionConfig) (*ssh.Client, error) {
+	key := bastionKey(bastion)
+
+	p.mu.Lock()
+	pc, ok := p.clients[key]
+	if ok {
+		pc.refs++
+	} else {
+		pc = &pooledClient{refs: 1, ready: make(chan struct{})}
+		p.clients[key] = pc
+		go p.connect(key, pc, bastion)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-pc.ready:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.unref(key, pc)
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+
+	if pc.err != nil {
+		return nil, pc.err
+	}
+	return pc.client, nil
+}
+
+// connect dials a pooled connection without holding the lock, so other
+// bastions aren't blocked, and wakes everyone waiting for it
+func (p *clientPool) connect(key string, pc *pooledClient, bastion *config.BastionConfig) {
+	client, err := p.dial(bastion)
+
+	p.mu.Lock()
+	pc.client, pc.err = client, err
+	if err != nil {
+		pc.refs = 0
+		if p.clients[key] == pc {
+			delete(p.clients, key)
+		}
+	}
+	abandoned := err == nil && pc.refs <= 0
+	if abandoned && p.clients[key] == pc {
+		delete(p.clients, key)
+	}
+	p.mu.Unlock()
+	close(pc.ready)
+
+	if err != nil {
+		slog.Warn("failed to connect to bastion", "bastion", bastion.RouteString(), "error", err)
+		return
+	}
+	if abandoned {
+		// Every caller gave up while the dial was in progress
+		client.Close()
+		return
+	}
+	slog.Debug("connected to bastion", "bastion", bastion.RouteString())
+
+	if interval := keepAliveInterval(bastion); interval > 0 {
+		go keepAlive(client, interval)
+	}
+
+	// Drop the connection from the pool once it dies so the next acquire redials
+	go func() {
+		client.Wait()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.clients[key] == pc {
+			delete(p.clients, key)
+		}
+	}()
+}
+
+// unref drops a reference taken by a caller that stopped waiting, closing the
+// connection if it was the last one. The caller must hold p.mu.
+func (p *clientPool) unref(key string, pc *pooledClient) {
+	pc.refs--
+	if pc.refs > 0 || pc.client == nil {
+		return
+	}
+	if p.clients[key] == pc {
+		delete(p.clients, key)
+	}
+	pc.client.Close()
+}
+
+// release drops a reference to a connection and closes it after the last one
+func (p *clientPool) release(client *ssh.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, pc := range p.clients {
+		if pc.client != client {
+			continue
+		}
+		pc.refs--
+		if pc.refs <= 0 {
+			delete(p.clients, key)
+			client.Close()
+		}
+		return
+	}
+
+	// The connection already died and left the pool
+	client.Close()
+}
+
+// discard drops a dead connection from the pool right away, so that the
+// next acquire dials a new one, and closes it
+func (p *clientPool) discard(client *ssh.Client) {
+	p.mu.Lock()
+	for key, pc := range p.clients {
+		if pc.client == client {
+			delete(p.clients, key)
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	client.Close()
+}
+
+// closeAll closes every pooled connection
+func (p *clientPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, pc := range p.clients {
+		if pc.client != nil {
+			pc.client.Close()
+		}
+		delete(p.clients, key)
+	}
+}
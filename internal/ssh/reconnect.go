@@ -0,0 +1,203 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"mytunnel/internal/config"
+)
+
+const (
+	// defaultKeepAliveInterval is used when a bastion doesn't set keepalive_interval
+	defaultKeepAliveInterval = 30 * time.Second
+
+	// initialBackoff and maxBackoff bound the delay between reconnect attempts
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// keepAliveInterval returns the keepalive interval for a bastion, or 0 if disabled
+func keepAliveInterval(bastion *config.BastionConfig) time.Duration {
+	switch {
+	case bastion.KeepAliveInterval < 0:
+		return 0
+	case bastion.KeepAliveInterval == 0:
+		return defaultKeepAliveInterval
+	default:
+		return bastion.KeepAliveInterval
+	}
+}
+
+// keepAlive sends keepalive@openssh.com requests until the connection ends.
+// A request that fails or goes unanswered for a whole interval closes the
+// connection, so everything waiting on it notices the bastion is gone.
+func keepAlive(client *ssh.Client, interval time.Duration) {
+	closed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case <-closed:
+			return
+		case err := <-reply:
+			if err != nil {
+				slog.Warn("keepalive failed, closing connection", "remote", client.RemoteAddr().String(), "error", err)
+				client.Close()
+				return
+			}
+		case <-time.After(interval):
+			slog.Warn("keepalive timed out, closing connection", "remote", client.RemoteAddr().String())
+			client.Close()
+			return
+		}
+	}
+}
+
+// currentClient returns the tunnel's SSH connection, or nil while reconnecting
+func (t *Tunnel) currentClient() *ssh.Client {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client
+}
+
+// currentListener returns the listener accepting the tunnel's connections
+func (t *Tunnel) currentListener() net.Listener {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.listener
+}
+
+// dial opens a connection from the bastion to addr
+func (t *Tunnel) dial(addr string) (net.Conn, error) {
+	client := t.currentClient()
+	if client == nil {
+		return nil, fmt.Errorf("tunnel is reconnecting")
+	}
+	return client.Dial("tcp", addr)
+}
+
+// monitor waits for the tunnel's SSH connection to die and re-dials it,
+// keeping the local listener bound, until the tunnel is closed
+func (tm *TunnelManager) monitor(t *Tunnel) {
+	for {
+		client := t.currentClient()
+		if client == nil {
+			return
+		}
+
+		lost := make(chan struct{})
+		go func() {
+			client.Wait()
+			close(lost)
+		}()
+
+		select {
+		case <-t.done:
+			return
+		case <-lost:
+		}
+
+		if !tm.reconnect(t, client) {
+			return
+		}
+	}
+}
+
+// reconnect replaces a dead connection with exponential backoff between attempts.
+// It returns false if the tunnel was closed before the connection came back.
+func (tm *TunnelManager) reconnect(t *Tunnel, dead *ssh.Client) bool {
+	lastErr := errors.New("bastion connection lost")
+	t.mu.Lock()
+	if !t.transitionLocked(StateReconnecting, lastErr) {
+		t.mu.Unlock()
+		return false
+	}
+	t.client = nil
+	t.mu.Unlock()
+	tm.pool.discard(dead)
+
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		t.mu.Lock()
+		if !t.transitionLocked(StateReconnecting, lastErr) {
+			t.mu.Unlock()
+			return false
+		}
+		t.status.Retries = attempt
+		t.mu.Unlock()
+		t.emit(Event{Type: EventReconnecting, Attempt: attempt, Err: lastErr})
+
+		select {
+		case <-t.done:
+			return false
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		ctx, cancel := t.withDone(context.Background())
+		client, err := tm.acquireClient(ctx, t.Bastion)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// A remote listener lives on the connection, so it has to be requested again
+		var listener net.Listener
+		if t.Type == RemoteTunnel {
+			listener, err = client.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", t.RemotePort))
+			if err != nil {
+				lastErr = fmt.Errorf("failed to restore remote listener: %w", err)
+				tm.releaseClient(client)
+				continue
+			}
+		}
+
+		t.mu.Lock()
+		if !t.transitionLocked(StateListening, nil) {
+			t.mu.Unlock()
+			if listener != nil {
+				listener.Close()
+			}
+			tm.releaseClient(client)
+			return false
+		}
+		t.client = client
+		if listener != nil {
+			t.listener = listener
+		}
+		t.mu.Unlock()
+
+		if listener != nil {
+			go t.handleConnections()
+		}
+		t.emit(Event{Type: EventConnected, Attempt: attempt})
+		return true
+	}
+}
@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"mytunnel/internal/config"
+)
+
+// CreateReverseTunnel exposes a local port on the bastion, like ssh -R.
+// A remotePort of 0 lets the bastion pick a free port; the port actually
+// allocated is returned.
+func (tm *TunnelManager) CreateReverseTunnel(remotePort, localPort int, bastion *config.BastionConfig) (int, error) {
+	return tm.CreateReverseTunnelContext(context.Background(), remotePort, localPort, bastion)
+}
+
+// CreateReverseTunnelContext is CreateReverseTunnel with a context that can
+// cancel the connection to the bastion. The tunnel is listed as Connecting
+// until the bastion answers, as R:0 if the bastion is to pick the port, so
+// only one such tunnel can be connecting at a time.
+func (tm *TunnelManager) CreateReverseTunnelContext(ctx context.Context, remotePort, localPort int, bastion *config.BastionConfig) (int, error) {
+	tunnel := tm.newTunnel(RemoteTunnel, bastion)
+	tunnel.LocalPort = localPort
+	tunnel.RemotePort = remotePort
+
+	// Reserve the remote port so that the tunnel is listed while the bastion is dialed
+	tm.mu.Lock()
+	if _, exists := tm.reverse[remotePort]; exists {
+		tm.mu.Unlock()
+		if remotePort == 0 {
+			return 0, fmt.Errorf("another reverse tunnel is already waiting for the bastion to pick its port")
+		}
+		return 0, fmt.Errorf("reverse tunnel already exists on remote port %d", remotePort)
+	}
+	tm.reverse[remotePort] = tunnel
+	tunnel.transition(StateConnecting, nil)
+	tm.mu.Unlock()
+	tunnel.emit(Event{Type: EventCreated})
+
+	client, err := tm.connect(ctx, tunnel)
+	if err != nil {
+		tm.dropReverse(remotePort, tunnel)
+		return 0, err
+	}
+
+	// Ask the bastion to listen; sshd's GatewayPorts decides which interfaces are used
+	listener, err := client.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", remotePort))
+	if err != nil {
+		tm.releaseClient(client)
+		tunnel.fail("failed to start remote listener", err)
+		tm.dropReverse(remotePort, tunnel)
+		return 0, fmt.Errorf("failed to start remote listener: %w", err)
+	}
+
+	if remotePort == 0 {
+		allocated := 0
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+			allocated = addr.Port
+		}
+		if err := tm.moveReverse(tunnel, allocated); err != nil {
+			listener.Close()
+			tm.releaseClient(client)
+			tunnel.fail("failed to start remote listener", err)
+			return 0, err
+		}
+		remotePort = allocated
+	}
+
+	if !tunnel.attach(client, listener) {
+		listener.Close()
+		tm.releaseClient(client)
+		tm.dropReverse(remotePort, tunnel)
+		return 0, fmt.Errorf("reverse tunnel on remote port %d was closed while connecting", remotePort)
+	}
+	tunnel.emit(Event{Type: EventConnected})
+
+	// Start handling connections
+	go tunnel.handleConnections()
+	go tm.monitor(tunnel)
+	go tm.enforceLimits(tunnel)
+
+	return remotePort, nil
+}
+
+// moveReverse registers a reverse tunnel opened on port 0 under the port the
+// bastion allocated for it
+func (tm *TunnelManager) moveReverse(tunnel *Tunnel, remotePort int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.reverse[0] != tunnel {
+		return fmt.Errorf("reverse tunnel was closed while connecting")
+	}
+	delete(tm.reverse, 0)
+	if _, exists := tm.reverse[remotePort]; exists {
+		return fmt.Errorf("reverse tunnel already exists on remote port %d", remotePort)
+	}
+	tunnel.mu.Lock()
+	tunnel.RemotePort = remotePort
+	tunnel.mu.Unlock()
+	tm.reverse[remotePort] = tunnel
+	return nil
+}
+
+// dropReverse unregisters a reverse tunnel that failed to start
+func (tm *TunnelManager) dropReverse(remotePort int, tunnel *Tunnel) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if tm.reverse[remotePort] == tunnel {
+		delete(tm.reverse, remotePort)
+	}
+}
+
+// handleRemoteConnection forwards a connection accepted on the bastion to the local port
+func (t *Tunnel) handleRemoteConnection(remote net.Conn) {
+	local, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", t.LocalPort))
+	if err != nil {
+		t.dialFailed(fmt.Sprintf("failed to connect to local port %d", t.LocalPort), err)
+		remote.Close()
+		return
+	}
+	t.dialSucceeded()
+
+	t.bridge(local, remote)
+}
+
+// Port returns the port the tunnel listens on: the bastion port for remote
+// tunnels and the local port otherwise. A remote tunnel opened on port 0 is
+// on port 0 until the bastion allocates one.
+func (t *Tunnel) Port() int {
+	if t.Type != RemoteTunnel {
+		return t.LocalPort
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.RemotePort
+}
+
+// CloseReverseTunnel closes the reverse tunnel listening on a bastion port
+func (tm *TunnelManager) CloseReverseTunnel(remotePort int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tunnel, exists := tm.reverse[remotePort]
+	if !exists {
+		return fmt.Errorf("no reverse tunnel exists on remote port %d", remotePort)
+	}
+
+	tm.stopTunnel(tunnel)
+	delete(tm.reverse, remotePort)
+
+	return nil
+}
+
+// ListReverseTunnels returns the active reverse tunnels ordered by remote port
+func (tm *TunnelManager) ListReverseTunnels() []*Tunnel {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tunnels := make([]*Tunnel, 0, len(tm.reverse))
+	for _, tunnel := range tm.reverse {
+		tunnels = append(tunnels, tunnel)
+	}
+	sort.Slice(tunnels, func(i, j int) bool {
+		return tunnels[i].RemotePort < tunnels[j].RemotePort
+	})
+	return tunnels
+}
@@ -0,0 +1,249 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"mytunnel/internal/config"
+)
+
+// SOCKS protocol constants
+const (
+	socks4Version = 0x04
+	socks5Version = 0x05
+
+	socksCmdConnect = 0x01
+
+	socks4Granted  = 0x5a
+	socks4Rejected = 0x5b
+
+	socks5NoAuth              = 0x00
+	socks5NoAcceptableMethods = 0xff
+
+	socks5Succeeded               = 0x00
+	socks5GeneralFailure          = 0x01
+	socks5HostUnreachable         = 0x04
+	socks5CommandNotSupported     = 0x07
+	socks5AddressTypeNotSupported = 0x08
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+)
+
+// socksHandshakeTimeout bounds how long a client may take to send its request
+const socksHandshakeTimeout = 10 * time.Second
+
+// errSocksRejected reports a request that was answered with an error reply
+var errSocksRejected = errors.New("socks request rejected")
+
+// CreateDynamicTunnel starts a local SOCKS proxy that opens every requested
+// connection through the bastion, like ssh -D
+func (tm *TunnelManager) CreateDynamicTunnel(localPort int, bastion *config.BastionConfig) error {
+	return tm.CreateDynamicTunnelContext(context.Background(), localPort, bastion)
+}
+
+// CreateDynamicTunnelContext is CreateDynamicTunnel with a context that can
+// cancel the connection to the bastion
+func (tm *TunnelManager) CreateDynamicTunnelContext(ctx context.Context, localPort int, bastion *config.BastionConfig) error {
+	tunnel := tm.newTunnel(DynamicTunnel, bastion)
+	tunnel.LocalPort = localPort
+
+	return tm.openLocal(ctx, tunnel)
+}
+
+// handleSocksConnection serves a single SOCKS4, SOCKS4a or SOCKS5 client
+func (t *Tunnel) handleSocksConnection(local net.Conn) {
+	local.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	reader := bufio.NewReader(local)
+
+	version, err := reader.ReadByte()
+	if err != nil {
+		local.Close()
+		return
+	}
+
+	var remote net.Conn
+	switch version {
+	case socks5Version:
+		remote, err = t.socks5Connect(local, reader)
+	case socks4Version:
+		remote, err = t.socks4Connect(local, reader)
+	default:
+		err = fmt.Errorf("unsupported socks version %d", version)
+	}
+	if err != nil {
+		if !errors.Is(err, errSocksRejected) && !errors.Is(err, io.EOF) {
+			t.emit(Event{Type: EventError, Message: "SOCKS request failed", Err: err})
+		}
+		local.Close()
+		return
+	}
+	local.SetDeadline(time.Time{})
+
+	// The client may have pipelined data after its request
+	if n := reader.Buffered(); n > 0 {
+		data, _ := reader.Peek(n)
+		written, err := remote.Write(data)
+		t.bytesOut.Add(int64(written))
+		if err != nil {
+			local.Close()
+			remote.Close()
+			return
+		}
+	}
+
+	t.bridge(local, remote)
+}
+
+// socks5Connect negotiates a SOCKS5 CONNECT request and dials its destination
+func (t *Tunnel) socks5Connect(local net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	// Method selection: NMETHODS followed by the methods
+	count, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	methods := make([]byte, count)
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return nil, err
+	}
+
+	noAuth := false
+	for _, method := range methods {
+		if method == socks5NoAuth {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		local.Write([]byte{socks5Version, socks5NoAcceptableMethods})
+		return nil, errSocksRejected
+	}
+	if _, err := local.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return nil, err
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unexpected socks version %d in request", header[0])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if header[3] == socks5AtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case socks5AtypDomain:
+		length, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		domain := make([]byte, length)
+		if _, err := io.ReadFull(reader, domain); err != nil {
+			return nil, err
+		}
+		// Leave name resolution to the bastion
+		host = string(domain)
+	default:
+		socks5Reply(local, socks5AddressTypeNotSupported)
+		return nil, errSocksRejected
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(reader, portBytes); err != nil {
+		return nil, err
+	}
+	port := binary.BigEndian.Uint16(portBytes)
+
+	if header[1] != socksCmdConnect {
+		socks5Reply(local, socks5CommandNotSupported)
+		return nil, errSocksRejected
+	}
+
+	remote, err := t.dial(net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		t.dialFailed(fmt.Sprintf("failed to connect to %s:%d", host, port), err)
+		socks5Reply(local, socks5HostUnreachable)
+		return nil, errSocksRejected
+	}
+	t.dialSucceeded()
+
+	if err := socks5Reply(local, socks5Succeeded); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// socks5Reply sends a SOCKS5 reply with an unspecified bound address
+func socks5Reply(local net.Conn, status byte) error {
+	_, err := local.Write([]byte{socks5Version, status, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socks4Connect handles a SOCKS4 or SOCKS4a CONNECT request and dials its destination
+func (t *Tunnel) socks4Connect(local net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	// Request: CD DSTPORT DSTIP USERID NUL [HOSTNAME NUL]
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	port := binary.BigEndian.Uint16(header[1:3])
+	ip := net.IP(header[3:7])
+
+	// The user ID is ignored
+	if _, err := reader.ReadString(0); err != nil {
+		return nil, err
+	}
+
+	host := ip.String()
+	// SOCKS4a marks a hostname with a destination of 0.0.0.x where x is non-zero
+	if ip[0] == 0 && ip[1] == 0 && ip[2] == 0 && ip[3] != 0 {
+		domain, err := reader.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		host = domain[:len(domain)-1]
+	}
+
+	if header[0] != socksCmdConnect {
+		socks4Reply(local, socks4Rejected)
+		return nil, errSocksRejected
+	}
+
+	remote, err := t.dial(net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		t.dialFailed(fmt.Sprintf("failed to connect to %s:%d", host, port), err)
+		socks4Reply(local, socks4Rejected)
+		return nil, errSocksRejected
+	}
+	t.dialSucceeded()
+
+	if err := socks4Reply(local, socks4Granted); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// socks4Reply sends a SOCKS4 reply
+func socks4Reply(local net.Conn, status byte) error {
+	_, err := local.Write([]byte{0x00, status, 0, 0, 0, 0, 0, 0})
+	return err
+}
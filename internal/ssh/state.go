@@ -0,0 +1,171 @@
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"mytunnel/internal/config"
+)
+
+// TunnelState is a step in the lifecycle of a tunnel
+type TunnelState int
+
+const (
+	// StatePending is a tunnel that has been created but not started
+	StatePending TunnelState = iota
+	// StateConnecting is a tunnel dialing the bastion for the first time
+	StateConnecting
+	// StateListening is a tunnel that is connected and forwarding
+	StateListening
+	// StateDegraded is a connected tunnel whose last forwarded connection failed
+	StateDegraded
+	// StateReconnecting is a tunnel that lost its bastion connection and is re-dialing
+	StateReconnecting
+	// StateFailed is a tunnel that could not be established
+	StateFailed
+	// StateClosing is a tunnel being shut down
+	StateClosing
+	// StateClosed is a tunnel that has been shut down
+	StateClosed
+)
+
+// String returns the display name of the state
+func (s TunnelState) String() string {
+	switch s {
+	case StatePending:
+		return "Pending"
+	case StateConnecting:
+		return "Connecting"
+	case StateListening:
+		return "Listening"
+	case StateDegraded:
+		return "Degraded"
+	case StateReconnecting:
+		return "Reconnecting"
+	case StateFailed:
+		return "Failed"
+	case StateClosing:
+		return "Closing"
+	case StateClosed:
+		return "Closed"
+	default:
+		return "Unknown"
+	}
+}
+
+// MarshalText encodes the state by name
+func (s TunnelState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state name
+func (s *TunnelState) UnmarshalText(text []byte) error {
+	for state := StatePending; state <= StateClosed; state++ {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid tunnel state %q", text)
+}
+
+// Active reports whether a tunnel in this state still holds resources
+func (s TunnelState) Active() bool {
+	return s != StateFailed && s != StateClosed
+}
+
+// tunnelTransitions lists the states each state may move to
+var tunnelTransitions = map[TunnelState][]TunnelState{
+	StatePending:      {StateConnecting, StateClosing},
+	StateConnecting:   {StateListening, StateFailed, StateClosing},
+	StateListening:    {StateDegraded, StateReconnecting, StateClosing},
+	StateDegraded:     {StateListening, StateReconnecting, StateClosing},
+	StateReconnecting: {StateReconnecting, StateListening, StateClosing},
+	StateFailed:       {StateClosing},
+	StateClosing:      {StateClosed},
+	StateClosed:       {},
+}
+
+// TunnelStatus is a snapshot of a tunnel's state
+type TunnelStatus struct {
+	State TunnelState
+	// LastError is the most recent failure, kept after the tunnel recovers
+	LastError error
+	// Retries is the current reconnect attempt while Reconnecting
+	Retries int
+	// CreatedAt is when the tunnel was created
+	CreatedAt time.Time
+	// ChangedAt is when the tunnel entered its current state
+	ChangedAt time.Time
+	// ConnectedAt is when the bastion connection was last established
+	ConnectedAt time.Time
+}
+
+// newTunnel creates a tunnel in the Pending state
+func (tm *TunnelManager) newTunnel(tunnelType TunnelType, bastion *config.BastionConfig) *Tunnel {
+	now := time.Now()
+	tunnel := &Tunnel{
+		Type:    tunnelType,
+		Bastion: bastion,
+		done:    make(chan struct{}),
+		events:  tm.events,
+		status: TunnelStatus{
+			State:     StatePending,
+			CreatedAt: now,
+			ChangedAt: now,
+		},
+		limits: TunnelLimits{
+			IdleTimeout: bastion.IdleTimeout,
+			MaxLifetime: bastion.MaxLifetime,
+		},
+		openedAt: now,
+	}
+	tunnel.idleSince.Store(now.UnixNano())
+	return tunnel
+}
+
+// Status returns the tunnel's current state
+func (t *Tunnel) Status() TunnelStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// transition moves the tunnel to a new state, recording err as the last error
+// if it is non-nil. It returns false if the move isn't allowed from the
+// current state.
+func (t *Tunnel) transition(state TunnelState, err error) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.transitionLocked(state, err)
+}
+
+// transitionLocked is transition for callers already holding t.mu
+func (t *Tunnel) transitionLocked(state TunnelState, err error) bool {
+	allowed := false
+	for _, next := range tunnelTransitions[t.status.State] {
+		if next == state {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+
+	now := time.Now()
+	if state != t.status.State {
+		t.status.ChangedAt = now
+	}
+	if err != nil {
+		t.status.LastError = err
+	}
+	if state == StateListening && t.status.State != StateDegraded {
+		t.status.ConnectedAt = now
+	}
+	if state != StateReconnecting {
+		t.status.Retries = 0
+	}
+	t.status.State = state
+	return true
+}
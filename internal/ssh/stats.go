@@ -0,0 +1,37 @@
+package ssh
+
+import (
+	"time"
+)
+
+// TunnelStats is a snapshot of a tunnel's traffic counters. Bytes are counted
+// from the point of view of the local side: BytesIn is what it received
+// through the tunnel, BytesOut is what it sent.
+type TunnelStats struct {
+	BytesIn      int64     `json:"bytes_in"`
+	BytesOut     int64     `json:"bytes_out"`
+	ActiveConns  int64     `json:"active_conns"`
+	TotalConns   int64     `json:"total_conns"`
+	DialErrors   int64     `json:"dial_errors"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// Stats returns the current traffic counters of the tunnel
+func (t *Tunnel) Stats() TunnelStats {
+	stats := TunnelStats{
+		BytesIn:     t.bytesIn.Load(),
+		BytesOut:    t.bytesOut.Load(),
+		ActiveConns: t.activeConns.Load(),
+		TotalConns:  t.totalConns.Load(),
+		DialErrors:  t.dialErrors.Load(),
+	}
+	if last := t.lastActivity.Load(); last != 0 {
+		stats.LastActivity = time.Unix(0, last)
+	}
+	return stats
+}
+
+// touch records activity on the tunnel
+func (t *Tunnel) touch() {
+	t.lastActivity.Store(time.Now().UnixNano())
+}
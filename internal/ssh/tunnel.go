@@ -1,201 +1,452 @@
-package ssh
-
-import (
-	"fmt"
-	"io/ioutil"
-	"net"
-	"sync"
-	"time"
-
-	"golang.org/x/crypto/ssh"
-	"mytunnel/internal/config"
-)
-
-// Tunnel represents an active SSH tunnel
-type Tunnel struct {
-	LocalPort  int
-	RemotePort int
-	Bastion    *config.BastionConfig
-	listener   net.Listener
-	client     *ssh.Client
-	done       chan struct{}
-}
-
-// TunnelManager manages multiple SSH tunnels
-type TunnelManager struct {
-	tunnels map[int]*Tunnel
-	mu      sync.RWMutex
-}
-
-// NewTunnelManager creates a new tunnel manager
-func NewTunnelManager() *TunnelManager {
-	return &TunnelManager{
-		tunnels: make(map[int]*Tunnel),
-	}
-}
-
-// CreateTunnel establishes a new SSH tunnel
-func (tm *TunnelManager) CreateTunnel(localPort, remotePort int, bastion *config.BastionConfig) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
-	if _, exists := tm.tunnels[localPort]; exists {
-		return fmt.Errorf("tunnel already exists on local port %d", localPort)
-	}
-
-	// Create SSH client configuration
-	config := &ssh.ClientConfig{
-		User:            bastion.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Second * 10,
-	}
-
-	// Set up authentication
-	if bastion.AuthType == "key" {
-		key, err := ioutil.ReadFile(bastion.KeyPath)
-		if err != nil {
-			return fmt.Errorf("failed to read private key: %w", err)
-		}
-
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return fmt.Errorf("failed to parse private key: %w", err)
-		}
-		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
-	} else {
-		config.Auth = []ssh.AuthMethod{ssh.Password(bastion.Password)}
-	}
-
-	// Connect to bastion
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", bastion.Host, bastion.Port), config)
-	if err != nil {
-		return fmt.Errorf("failed to connect to bastion: %w", err)
-	}
-
-	// Start local listener
-	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", localPort))
-	if err != nil {
-		client.Close()
-		return fmt.Errorf("failed to start local listener: %w", err)
-	}
-
-	tunnel := &Tunnel{
-		LocalPort:  localPort,
-		RemotePort: remotePort,
-		Bastion:    bastion,
-		listener:   listener,
-		client:     client,
-		done:       make(chan struct{}),
-	}
-
-	tm.tunnels[localPort] = tunnel
-
-	// Start handling connections
-	go tunnel.handleConnections()
-
-	return nil
-}
-
-// handleConnections handles incoming connections to the tunnel
-func (t *Tunnel) handleConnections() {
-	for {
-		select {
-		case <-t.done:
-			return
-		default:
-			conn, err := t.listener.Accept()
-			if err != nil {
-				select {
-				case <-t.done:
-					return
-				default:
-					fmt.Printf("Failed to accept connection: %v\n", err)
-					continue
-				}
-			}
-			go t.handleConnection(conn)
-		}
-	}
-}
-
-// handleConnection forwards a single connection through the tunnel
-func (t *Tunnel) handleConnection(local net.Conn) {
-	remote, err := t.client.Dial("tcp", fmt.Sprintf("localhost:%d", t.RemotePort))
-	if err != nil {
-		fmt.Printf("Failed to connect to remote port: %v\n", err)
-		local.Close()
-		return
-	}
-
-	// Copy data bidirectionally
-	go func() {
-		defer local.Close()
-		defer remote.Close()
-		copyData(local, remote)
-	}()
-
-	go func() {
-		defer local.Close()
-		defer remote.Close()
-		copyData(remote, local)
-	}()
-}
-
-// copyData copies data between connections
-func copyData(dst, src net.Conn) {
-	defer dst.Close()
-	defer src.Close()
-	buffer := make([]byte, 32*1024)
-	for {
-		n, err := src.Read(buffer)
-		if err != nil {
-			return
-		}
-		if _, err := dst.Write(buffer[:n]); err != nil {
-			return
-		}
-	}
-}
-
-// CloseTunnel closes a specific tunnel
-func (tm *TunnelManager) CloseTunnel(localPort int) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
-	tunnel, exists := tm.tunnels[localPort]
-	if !exists {
-		return fmt.Errorf("no tunnel exists on local port %d", localPort)
-	}
-
-	close(tunnel.done)
-	tunnel.listener.Close()
-	tunnel.client.Close()
-	delete(tm.tunnels, localPort)
-
-	return nil
-}
-
-// ListTunnels returns a list of active tunnels
-func (tm *TunnelManager) ListTunnels() []*Tunnel {
-	tm.mu.RLock()
-	defer tm.mu.RUnlock()
-
-	tunnels := make([]*Tunnel, 0, len(tm.tunnels))
-	for _, tunnel := range tm.tunnels {
-		tunnels = append(tunnels, tunnel)
-	}
-	return tunnels
-}
-
-// CloseAll closes all active tunnels
-func (tm *TunnelManager) CloseAll() {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
-	for port, tunnel := range tm.tunnels {
-		close(tunnel.done)
-		tunnel.listener.Close()
-		tunnel.client.Close()
-		delete(tm.tunnels, port)
-	}
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"mytunnel/internal/config"
+)
+
+// TunnelType is the forwarding direction of a tunnel
+type TunnelType int
+
+const (
+	// LocalTunnel forwards a local port to a port on the bastion, like ssh -L
+	LocalTunnel TunnelType = iota
+	// RemoteTunnel forwards a port on the bastion to a local port, like ssh -R
+	RemoteTunnel
+	// DynamicTunnel runs a local SOCKS proxy that connects through the bastion, like ssh -D
+	DynamicTunnel
+)
+
+// String returns the display name of the tunnel type
+func (t TunnelType) String() string {
+	switch t {
+	case RemoteTunnel:
+		return "remote"
+	case DynamicTunnel:
+		return "dynamic"
+	default:
+		return "local"
+	}
+}
+
+// ParseTunnelType parses the display name of a tunnel type
+func ParseTunnelType(name string) (TunnelType, error) {
+	for _, t := range []TunnelType{LocalTunnel, RemoteTunnel, DynamicTunnel} {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid tunnel type %q: must be one of local, remote or dynamic", name)
+}
+
+// MarshalText encodes the tunnel type by name
+func (t TunnelType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a tunnel type name
+func (t *TunnelType) UnmarshalText(text []byte) error {
+	parsed, err := ParseTunnelType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Tunnel represents an active SSH tunnel
+type Tunnel struct {
+	Type       TunnelType
+	LocalPort  int
+	RemoteHost string
+	RemotePort int
+	Bastion    *config.BastionConfig
+	listener   net.Listener
+	client     *ssh.Client
+	done       chan struct{}
+	events     *eventBus
+	status     TunnelStatus
+	limits     TunnelLimits
+	openedAt   time.Time
+	mu         sync.Mutex
+
+	// Traffic counters, see Stats
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	activeConns  atomic.Int64
+	totalConns   atomic.Int64
+	dialErrors   atomic.Int64
+	lastActivity atomic.Int64
+	idleSince    atomic.Int64
+}
+
+// TunnelManager manages multiple SSH tunnels
+type TunnelManager struct {
+	tunnels  map[int]*Tunnel
+	reverse  map[int]*Tunnel
+	hostKeys *HostKeyVerifier
+	pool     *clientPool
+	events   *eventBus
+	mu       sync.RWMutex
+}
+
+// NewTunnelManager creates a new tunnel manager
+func NewTunnelManager() *TunnelManager {
+	tm := &TunnelManager{
+		tunnels:  make(map[int]*Tunnel),
+		reverse:  make(map[int]*Tunnel),
+		hostKeys: NewHostKeyVerifier(),
+		events:   newEventBus(),
+	}
+	tm.pool = newClientPool(tm.dial)
+
+	logged, _ := tm.Subscribe()
+	go logEvents(logged)
+
+	return tm
+}
+
+// SetHostKeyPrompt sets the function used to confirm unknown bastion host keys
+func (tm *TunnelManager) SetHostKeyPrompt(prompt HostKeyPrompt) {
+	tm.hostKeys.SetPrompt(prompt)
+}
+
+// dial opens an SSH connection to a bastion with host key verification
+func (tm *TunnelManager) dial(bastion *config.BastionConfig) (*ssh.Client, error) {
+	return dialBastion(bastion, tm.hostKeys)
+}
+
+// acquireClient returns the shared SSH connection for a bastion
+func (tm *TunnelManager) acquireClient(ctx context.Context, bastion *config.BastionConfig) (*ssh.Client, error) {
+	return tm.pool.acquire(ctx, bastion)
+}
+
+// releaseClient gives back a connection obtained from acquireClient
+func (tm *TunnelManager) releaseClient(client *ssh.Client) {
+	tm.pool.release(client)
+}
+
+// CreateTunnel establishes a new SSH tunnel from a local port to remoteHost:remotePort
+// as seen from the bastion, like ssh -L localPort:remoteHost:remotePort. An empty
+// remoteHost targets the bastion itself.
+func (tm *TunnelManager) CreateTunnel(localPort int, remoteHost string, remotePort int, bastion *config.BastionConfig) error {
+	return tm.CreateTunnelContext(context.Background(), localPort, remoteHost, remotePort, bastion)
+}
+
+// CreateTunnelContext is CreateTunnel with a context that can cancel the
+// connection to the bastion. The local port is reserved before dialing, and
+// the tunnel is listed as Connecting until the bastion answers.
+func (tm *TunnelManager) CreateTunnelContext(ctx context.Context, localPort int, remoteHost string, remotePort int, bastion *config.BastionConfig) error {
+	if remoteHost == "" {
+		remoteHost = "localhost"
+	}
+
+	tunnel := tm.newTunnel(LocalTunnel, bastion)
+	tunnel.LocalPort = localPort
+	tunnel.RemoteHost = remoteHost
+	tunnel.RemotePort = remotePort
+
+	return tm.openLocal(ctx, tunnel)
+}
+
+// openLocal reserves the local port of a local or dynamic tunnel, then
+// connects it to the bastion without holding the manager lock
+func (tm *TunnelManager) openLocal(ctx context.Context, tunnel *Tunnel) error {
+	tm.mu.Lock()
+	if _, exists := tm.tunnels[tunnel.LocalPort]; exists {
+		tm.mu.Unlock()
+		return fmt.Errorf("tunnel already exists on local port %d", tunnel.LocalPort)
+	}
+
+	// Bind the port first so it can't be taken while the bastion is dialed
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", tunnel.LocalPort))
+	if err != nil {
+		tm.mu.Unlock()
+		return fmt.Errorf("failed to start local listener: %w", err)
+	}
+	tunnel.listener = listener
+	tunnel.transition(StateConnecting, nil)
+	tm.tunnels[tunnel.LocalPort] = tunnel
+	tm.mu.Unlock()
+	tunnel.emit(Event{Type: EventCreated})
+
+	client, err := tm.connect(ctx, tunnel)
+	if err == nil && !tunnel.attach(client, nil) {
+		tm.releaseClient(client)
+		err = fmt.Errorf("tunnel on local port %d was closed while connecting", tunnel.LocalPort)
+	}
+	if err != nil {
+		tm.mu.Lock()
+		if tm.tunnels[tunnel.LocalPort] == tunnel {
+			delete(tm.tunnels, tunnel.LocalPort)
+		}
+		tm.mu.Unlock()
+		listener.Close()
+		return err
+	}
+	tunnel.emit(Event{Type: EventConnected})
+
+	// Start handling connections
+	go tunnel.handleConnections()
+	go tm.monitor(tunnel)
+	go tm.enforceLimits(tunnel)
+
+	return nil
+}
+
+// connect acquires the bastion connection for a new tunnel. It gives up when
+// ctx is cancelled or the tunnel is closed, leaving the tunnel Failed.
+func (tm *TunnelManager) connect(ctx context.Context, tunnel *Tunnel) (*ssh.Client, error) {
+	ctx, cancel := tunnel.withDone(ctx)
+	defer cancel()
+
+	// Connect to bastion, sharing the connection with other tunnels
+	client, err := tm.acquireClient(ctx, tunnel.Bastion)
+	if err != nil {
+		tunnel.fail("failed to connect to bastion", err)
+		return nil, err
+	}
+	return client, nil
+}
+
+// withDone returns a copy of ctx that is also cancelled when the tunnel is closed
+func (t *Tunnel) withDone(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-t.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// fail marks a tunnel that could not be established, unless it was closed first
+func (t *Tunnel) fail(message string, err error) {
+	if t.transition(StateFailed, fmt.Errorf("%s: %w", message, err)) {
+		t.emit(Event{Type: EventError, Message: message, Err: err})
+	}
+}
+
+// attach hands a connected tunnel its bastion connection, and its listener if
+// it lives on that connection. It returns false if the tunnel was closed.
+func (t *Tunnel) attach(client *ssh.Client, listener net.Listener) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.transitionLocked(StateListening, nil) {
+		return false
+	}
+	t.client = client
+	if listener != nil {
+		t.listener = listener
+	}
+	return true
+}
+
+// handleConnections handles incoming connections to the tunnel
+func (t *Tunnel) handleConnections() {
+	listener := t.currentListener()
+	for {
+		select {
+		case <-t.done:
+			return
+		default:
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-t.done:
+					return
+				default:
+					// A remote listener stops for good when its SSH connection drops
+					if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+						return
+					}
+					t.emit(Event{Type: EventError, Message: "failed to accept connection", Err: err})
+					continue
+				}
+			}
+
+			t.totalConns.Add(1)
+			t.touch()
+			t.emit(Event{Type: EventConnectionAccepted, Peer: conn.RemoteAddr().String()})
+
+			switch t.Type {
+			case RemoteTunnel:
+				go t.handleRemoteConnection(conn)
+			case DynamicTunnel:
+				go t.handleSocksConnection(conn)
+			default:
+				go t.handleConnection(conn)
+			}
+		}
+	}
+}
+
+// handleConnection forwards a single connection through the tunnel
+func (t *Tunnel) handleConnection(local net.Conn) {
+	client := t.currentClient()
+	if client == nil {
+		// Reconnecting, refuse rather than hang the caller
+		local.Close()
+		return
+	}
+
+	remote, err := client.Dial("tcp", t.RemoteAddr())
+	if err != nil {
+		t.dialFailed("failed to connect to "+t.RemoteAddr(), err)
+		local.Close()
+		return
+	}
+	t.dialSucceeded()
+
+	t.bridge(local, remote)
+}
+
+// ID identifies the tunnel by type and listening port, e.g. L:8080, R:9000 or D:1080
+func (t *Tunnel) ID() string {
+	return TunnelID(t.Type, t.Port())
+}
+
+// TunnelID returns the ID of the tunnel of the given type listening on port,
+// which is the bastion port for remote tunnels and the local port otherwise
+func TunnelID(tunnelType TunnelType, port int) string {
+	switch tunnelType {
+	case RemoteTunnel:
+		return fmt.Sprintf("R:%d", port)
+	case DynamicTunnel:
+		return fmt.Sprintf("D:%d", port)
+	default:
+		return fmt.Sprintf("L:%d", port)
+	}
+}
+
+// RemoteAddr returns the host:port the bastion connects to for this tunnel
+func (t *Tunnel) RemoteAddr() string {
+	return net.JoinHostPort(t.RemoteHost, strconv.Itoa(t.RemotePort))
+}
+
+// ParseHostPort parses a forwarding target given as host:port, [ipv6]:port or
+// just a port, in which case the host is empty
+func ParseHostPort(target string) (string, int, error) {
+	host, portStr := "", target
+	if strings.Contains(target, ":") {
+		var err error
+		host, portStr, err = net.SplitHostPort(target)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid target %q: %w", target, err)
+		}
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in target %q", target)
+	}
+	return host, port, nil
+}
+
+// CloseTunnel closes a specific tunnel
+func (tm *TunnelManager) CloseTunnel(localPort int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tunnel, exists := tm.tunnels[localPort]
+	if !exists {
+		return fmt.Errorf("no tunnel exists on local port %d", localPort)
+	}
+
+	tm.stopTunnel(tunnel)
+	delete(tm.tunnels, localPort)
+
+	return nil
+}
+
+// stopTunnel stops accepting connections and releases the bastion connection
+func (tm *TunnelManager) stopTunnel(tunnel *Tunnel) {
+	tunnel.mu.Lock()
+	tunnel.transitionLocked(StateClosing, nil)
+	close(tunnel.done)
+	listener, client := tunnel.listener, tunnel.client
+	tunnel.client = nil
+	tunnel.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+	if client != nil {
+		tm.releaseClient(client)
+	}
+	tunnel.transition(StateClosed, nil)
+	tunnel.emit(Event{Type: EventClosed})
+}
+
+// dialFailed records a forwarded connection that could not be opened
+func (t *Tunnel) dialFailed(message string, err error) {
+	t.dialErrors.Add(1)
+	t.transition(StateDegraded, fmt.Errorf("%s: %w", message, err))
+	t.emit(Event{Type: EventError, Message: message, Err: err})
+}
+
+// dialSucceeded clears the Degraded state after a forwarded connection opens
+func (t *Tunnel) dialSucceeded() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.State == StateDegraded {
+		t.transitionLocked(StateListening, nil)
+	}
+}
+
+// ListTunnels returns a list of active tunnels
+func (tm *TunnelManager) ListTunnels() []*Tunnel {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tunnels := make([]*Tunnel, 0, len(tm.tunnels))
+	for _, tunnel := range tm.tunnels {
+		tunnels = append(tunnels, tunnel)
+	}
+	return tunnels
+}
+
+// FindTunnel returns the tunnel with the given ID, such as L:8080 or R:9000
+func (tm *TunnelManager) FindTunnel(id string) (*Tunnel, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	for _, tunnels := range []map[int]*Tunnel{tm.tunnels, tm.reverse} {
+		for _, tunnel := range tunnels {
+			if tunnel.ID() == id {
+				return tunnel, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// CloseAll closes all active tunnels
+func (tm *TunnelManager) CloseAll() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	for port, tunnel := range tm.tunnels {
+		tm.stopTunnel(tunnel)
+		delete(tm.tunnels, port)
+	}
+	for port, tunnel := range tm.reverse {
+		tm.stopTunnel(tunnel)
+		delete(tm.reverse, port)
+	}
+	tm.pool.closeAll()
 } 
\ No newline at end of file
@@ -0,0 +1,352 @@
+// Package sshconfig reads the subset of OpenSSH client configuration files
+// that mytunnel can import: Host blocks with wildcard patterns, Include, and
+// the HostName, User, Port, IdentityFile, ProxyJump, ServerAliveInterval and
+// LocalForward keywords.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIncludeDepth bounds nested Include directives, like ssh itself does
+const maxIncludeDepth = 16
+
+// systemDir holds the system-wide ssh client configuration
+var systemDir = "/etc/ssh"
+
+// Forward is a LocalForward line
+type Forward struct {
+	LocalPort  int
+	RemoteHost string
+	RemotePort int
+}
+
+// Host is the configuration ssh would use for one host alias
+type Host struct {
+	Alias         string
+	HostName      string
+	User          string
+	Port          int
+	IdentityFiles []string
+	// ProxyJump lists the jump hosts in order, as written in the file
+	ProxyJump           []string
+	ServerAliveInterval time.Duration
+	LocalForwards       []Forward
+}
+
+// block is a Host or Match section and the options set in it
+type block struct {
+	patterns []string
+	// match is true for Match blocks, which are never applied
+	match   bool
+	options []option
+}
+
+// option is a single keyword line
+type option struct {
+	keyword string
+	args    []string
+	file    string
+	line    int
+}
+
+// File is a parsed ssh_config file with its includes inlined
+type File struct {
+	blocks []*block
+	// system is set when the file is in systemDir, where relative Include
+	// patterns are resolved instead of ~/.ssh
+	system bool
+}
+
+// DefaultPath returns the path of the user's ssh client configuration
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// Load parses an ssh_config file and the files it includes
+func Load(path string) (*File, error) {
+	f := &File{blocks: []*block{{patterns: []string{"*"}}}}
+	if abs, err := filepath.Abs(path); err == nil {
+		f.system = filepath.Dir(abs) == filepath.Clean(systemDir)
+	}
+	if err := f.parse(path, 0); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parse reads one file, appending its options to the current block
+func (f *File) parse(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: too many nested includes", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read ssh config: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		keyword, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			f.blocks = append(f.blocks, &block{patterns: args})
+		case "match":
+			f.blocks = append(f.blocks, &block{match: true})
+		case "include":
+			enclosing := f.blocks[len(f.blocks)-1]
+			for _, pattern := range args {
+				if err := f.include(pattern, depth); err != nil {
+					return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+				}
+			}
+			// Host lines in an included file don't leak into the rest of this one
+			if f.blocks[len(f.blocks)-1] != enclosing {
+				f.blocks = append(f.blocks, &block{patterns: enclosing.patterns, match: enclosing.match})
+			}
+		default:
+			current := f.blocks[len(f.blocks)-1]
+			current.options = append(current.options, option{keyword: keyword, args: args, file: path, line: lineNo})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ssh config: %w", err)
+	}
+	return nil
+}
+
+// include parses every file matching an Include pattern. Like ssh, relative
+// patterns are resolved against ~/.ssh in the user's configuration and
+// against /etc/ssh in the system one, including in the files they include.
+func (f *File) include(pattern string, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		if f.system {
+			pattern = filepath.Join(systemDir, pattern)
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("failed to get user home directory: %w", err)
+			}
+			pattern = filepath.Join(home, ".ssh", pattern)
+		}
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid Include pattern %q: %w", pattern, err)
+	}
+	for _, match := range matches {
+		if err := f.parse(match, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLine splits a config line into its lowercased keyword and arguments.
+// The keyword may be separated by whitespace or an equals sign, and
+// arguments may be double quoted.
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			arg, rest = rest[1:closing+1], rest[closing+2:]
+		} else if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			arg, rest = rest[:i], rest[i:]
+		} else {
+			arg, rest = rest, ""
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	return keyword, args, nil
+}
+
+// Aliases returns every host alias named without wildcards or negation, in
+// the order they first appear
+func (f *File) Aliases() []string {
+	var aliases []string
+	seen := map[string]bool{}
+	for _, b := range f.blocks {
+		if b.match {
+			continue
+		}
+		for _, pattern := range b.patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			aliases = append(aliases, pattern)
+		}
+	}
+	return aliases
+}
+
+// Resolve returns the configuration ssh would use for alias: for every
+// keyword the first value from a matching Host block wins, while
+// IdentityFile and LocalForward accumulate
+func (f *File) Resolve(alias string) (Host, []string) {
+	host := Host{Alias: alias}
+	var warnings []string
+	set := map[string]bool{}
+
+	for _, b := range f.blocks {
+		if b.match || !matches(b.patterns, alias) {
+			continue
+		}
+		for _, opt := range b.options {
+			if len(opt.args) == 0 {
+				continue
+			}
+			accumulates := opt.keyword == "identityfile" || opt.keyword == "localforward"
+			if set[opt.keyword] && !accumulates {
+				continue
+			}
+			if err := host.apply(opt); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s:%d: %v", opt.file, opt.line, err))
+				continue
+			}
+			set[opt.keyword] = true
+		}
+	}
+
+	if host.HostName == "" {
+		host.HostName = alias
+	}
+	return host, warnings
+}
+
+// apply sets the field for one option. Unsupported keywords are ignored.
+func (h *Host) apply(opt option) error {
+	arg := opt.args[0]
+	switch opt.keyword {
+	case "hostname":
+		h.HostName = strings.NewReplacer("%h", h.Alias, "%%", "%").Replace(arg)
+	case "user":
+		h.User = arg
+	case "port":
+		port, err := strconv.Atoi(arg)
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid Port %q", arg)
+		}
+		h.Port = port
+	case "identityfile":
+		if strings.EqualFold(arg, "none") {
+			return nil
+		}
+		h.IdentityFiles = append(h.IdentityFiles, expandHome(arg))
+	case "proxyjump":
+		if strings.EqualFold(arg, "none") {
+			return nil
+		}
+		h.ProxyJump = strings.Split(arg, ",")
+	case "serveraliveinterval":
+		seconds, err := strconv.Atoi(arg)
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("invalid ServerAliveInterval %q", arg)
+		}
+		h.ServerAliveInterval = time.Duration(seconds) * time.Second
+	case "localforward":
+		forward, err := parseForward(opt.args)
+		if err != nil {
+			return err
+		}
+		h.LocalForwards = append(h.LocalForwards, forward)
+	}
+	return nil
+}
+
+// parseForward parses the arguments of LocalForward [bind:]port host:hostport.
+// The bind address is dropped since mytunnel always listens on localhost.
+func parseForward(args []string) (Forward, error) {
+	if len(args) != 2 {
+		return Forward{}, fmt.Errorf("LocalForward needs a listen port and a target")
+	}
+
+	listen := args[0]
+	if i := strings.LastIndex(listen, ":"); i >= 0 {
+		listen = listen[i+1:]
+	}
+	localPort, err := strconv.Atoi(listen)
+	if err != nil || localPort <= 0 || localPort > 65535 {
+		return Forward{}, fmt.Errorf("unsupported LocalForward listen address %q", args[0])
+	}
+
+	target := args[1]
+	i := strings.LastIndex(target, ":")
+	if i < 0 {
+		return Forward{}, fmt.Errorf("unsupported LocalForward target %q", target)
+	}
+	remotePort, err := strconv.Atoi(target[i+1:])
+	if err != nil || remotePort <= 0 || remotePort > 65535 {
+		return Forward{}, fmt.Errorf("unsupported LocalForward target %q", target)
+	}
+	remoteHost := strings.TrimSuffix(strings.TrimPrefix(target[:i], "["), "]")
+	return Forward{LocalPort: localPort, RemoteHost: remoteHost, RemotePort: remotePort}, nil
+}
+
+// matches reports whether alias matches a Host line: at least one pattern
+// must match and no negated pattern may
+func matches(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated := strings.HasPrefix(pattern, "!"); negated {
+			if ok, _ := filepath.Match(pattern[1:], alias); ok {
+				return false
+			}
+		} else if ok, _ := filepath.Match(pattern, alias); ok {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
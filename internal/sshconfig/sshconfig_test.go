@@ -0,0 +1,272 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		keyword string
+		args    []string
+		wantErr bool
+	}{
+		{"", "", nil, false},
+		{"   # comment", "", nil, false},
+		{"Host bastion", "host", []string{"bastion"}, false},
+		{"  HostName\t10.0.0.1  ", "hostname", []string{"10.0.0.1"}, false},
+		{"Port=2222", "port", []string{"2222"}, false},
+		{"Port = 2222", "port", []string{"2222"}, false},
+		{"Host web-* !web-old", "host", []string{"web-*", "!web-old"}, false},
+		{`IdentityFile "~/.ssh/my key"`, "identityfile", []string{"~/.ssh/my key"}, false},
+		{`LocalForward 8080 "db:5432"`, "localforward", []string{"8080", "db:5432"}, false},
+		{"ForwardAgent", "forwardagent", nil, false},
+		{`IdentityFile "~/.ssh/id`, "", nil, true},
+	}
+	for _, tt := range tests {
+		keyword, args, err := splitLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if keyword != tt.keyword || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("splitLine(%q) = %q, %q, want %q, %q", tt.line, keyword, args, tt.keyword, tt.args)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		alias    string
+		want     bool
+	}{
+		{[]string{"*"}, "anything", true},
+		{[]string{"bastion"}, "bastion", true},
+		{[]string{"bastion"}, "bastion2", false},
+		{[]string{"web-?"}, "web-1", true},
+		{[]string{"web-?"}, "web-10", false},
+		{[]string{"db", "web-*"}, "web-prod", true},
+		{[]string{"web-*", "!web-old"}, "web-old", false},
+		{[]string{"web-*", "!web-old"}, "web-new", true},
+		{[]string{"!web-old"}, "web-new", false},
+		{nil, "bastion", false},
+	}
+	for _, tt := range tests {
+		if got := matches(tt.patterns, tt.alias); got != tt.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", tt.patterns, tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    Forward
+		wantErr bool
+	}{
+		{[]string{"8080", "localhost:80"}, Forward{8080, "localhost", 80}, false},
+		{[]string{"127.0.0.1:5432", "db.internal:5432"}, Forward{5432, "db.internal", 5432}, false},
+		{[]string{"[::1]:9000", "[2001:db8::1]:443"}, Forward{9000, "2001:db8::1", 443}, false},
+		{[]string{"8080"}, Forward{}, true},
+		{[]string{"http", "localhost:80"}, Forward{}, true},
+		{[]string{"70000", "localhost:80"}, Forward{}, true},
+		{[]string{"8080", "localhost"}, Forward{}, true},
+		{[]string{"8080", "localhost:0"}, Forward{}, true},
+		{[]string{"/tmp/local.sock", "localhost:80"}, Forward{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseForward(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseForward(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseForward(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// writeConfig writes an ssh_config file into dir and returns its path
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolve(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(filepath.Join(sshDir, "conf.d"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, sshDir, "conf.d/jump.conf", `
+Host jump
+  HostName jump.example.com
+  Port 2200
+`)
+	path := writeConfig(t, sshDir, "config", `
+Include conf.d/*.conf
+
+Host bastion
+  HostName %h.example.com
+  User alice
+  IdentityFile ~/.ssh/bastion
+  LocalForward 8080 localhost:80
+
+Host bastion jump
+  User ignored
+  ProxyJump none
+  ServerAliveInterval 30
+
+Host web-* !web-old
+  ProxyJump jump,bastion
+  Port 22x
+
+Match host bastion
+  User matched
+
+Host *
+  IdentityFile ~/.ssh/id_ed25519
+  LocalForward 127.0.0.1:5432 [db.internal]:5432
+  Port 22
+`)
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Aliases(), []string{"jump", "bastion"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Aliases() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		alias    string
+		want     Host
+		warnings int
+	}{
+		{
+			alias: "bastion",
+			want: Host{
+				Alias:               "bastion",
+				HostName:            "bastion.example.com",
+				User:                "alice",
+				Port:                22,
+				IdentityFiles:       []string{filepath.Join(home, ".ssh/bastion"), filepath.Join(home, ".ssh/id_ed25519")},
+				ServerAliveInterval: 30 * time.Second,
+				LocalForwards:       []Forward{{8080, "localhost", 80}, {5432, "db.internal", 5432}},
+			},
+		},
+		{
+			alias: "jump",
+			want: Host{
+				Alias:               "jump",
+				HostName:            "jump.example.com",
+				User:                "ignored",
+				Port:                2200,
+				IdentityFiles:       []string{filepath.Join(home, ".ssh/id_ed25519")},
+				ServerAliveInterval: 30 * time.Second,
+				LocalForwards:       []Forward{{5432, "db.internal", 5432}},
+			},
+		},
+		{
+			alias: "web-1",
+			want: Host{
+				Alias:         "web-1",
+				HostName:      "web-1",
+				Port:          22,
+				IdentityFiles: []string{filepath.Join(home, ".ssh/id_ed25519")},
+				ProxyJump:     []string{"jump", "bastion"},
+				LocalForwards: []Forward{{5432, "db.internal", 5432}},
+			},
+			warnings: 1,
+		},
+		{
+			alias: "web-old",
+			want: Host{
+				Alias:         "web-old",
+				HostName:      "web-old",
+				Port:          22,
+				IdentityFiles: []string{filepath.Join(home, ".ssh/id_ed25519")},
+				LocalForwards: []Forward{{5432, "db.internal", 5432}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, warnings := f.Resolve(tt.alias)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%q) = %+v, want %+v", tt.alias, got, tt.want)
+		}
+		if len(warnings) != tt.warnings {
+			t.Errorf("Resolve(%q) warnings = %q, want %d", tt.alias, warnings, tt.warnings)
+		}
+	}
+}
+
+func TestIncludeRelativePaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := t.TempDir()
+	old := systemDir
+	systemDir = filepath.Join(dir, "etc", "ssh")
+	t.Cleanup(func() { systemDir = old })
+	for _, d := range []string{filepath.Join(home, ".ssh", "conf.d"), filepath.Join(systemDir, "conf.d")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(t, home, ".ssh/conf.d/hosts.conf", "Host web\n  HostName user.example.com\n")
+	writeConfig(t, systemDir, "conf.d/hosts.conf", "Include nested.conf\nHost web\n  Port 2222\n")
+	writeConfig(t, systemDir, "nested.conf", "Host web\n  HostName system.example.com\n")
+	writeConfig(t, home, ".ssh/nested.conf", "Host web\n  HostName wrong.example.com\n")
+
+	tests := []struct {
+		name     string
+		path     string
+		hostName string
+		port     int
+	}{
+		{"user config", writeConfig(t, home, ".ssh/config", "Include conf.d/*.conf\n"), "user.example.com", 0},
+		{"system config", writeConfig(t, systemDir, "ssh_config", "Include conf.d/*.conf\n"), "system.example.com", 2222},
+	}
+	for _, tt := range tests {
+		f, err := Load(tt.path)
+		if err != nil {
+			t.Fatalf("Load(%s) error = %v", tt.name, err)
+		}
+		host, _ := f.Resolve("web")
+		if host.HostName != tt.hostName || host.Port != tt.port {
+			t.Errorf("%s: web = %s:%d, want %s:%d", tt.name, host.HostName, host.Port, tt.hostName, tt.port)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unterminated", "Host bastion\n  IdentityFile \"~/.ssh/id\n"},
+		{"include-loop", "Include " + filepath.Join(dir, "include-loop") + "\n"},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, dir, tt.name, tt.content)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) succeeded, want an error", tt.name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Load(missing) succeeded, want an error")
+	}
+}
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+	"mytunnel/internal/config"
+)
+
+// SetContext sets the context the UI starts in. It must not be called while
+// the UI is running.
+func (ui *UI) SetContext(context *config.Context) {
+	ui.context = context
+	ui.updateHeader()
+}
+
+// SetSwitchHandler sets the function called after the user switches to
+// another context, so port discovery can follow the new bastion
+func (ui *UI) SetSwitchHandler(onSwitch func(*config.BastionConfig, *config.Context)) {
+	ui.onSwitch = onSwitch
+}
+
+// OpenContext opens the tunnels of a context in the background and reports
+// failures in the status bar
+func (ui *UI) OpenContext(cfg *config.Config, c *config.Context) {
+	ui.openProfiles(cfg.ContextTunnels(c))
+}
+
+// showContexts lists the contexts and switches to the one picked
+func (ui *UI) showContexts() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: failed to load config: %v[-]", err))
+		return
+	}
+	if len(cfg.Contexts) == 0 {
+		ui.statusBar.SetText("[yellow]No contexts configured, add one with 'mytunnel config set-context'[-]")
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(true)
+	for _, name := range cfg.ContextNames() {
+		c := cfg.Contexts[name]
+		main := name
+		if name == cfg.CurrentContext {
+			main += " (current)"
+		}
+		secondary := "bastion " + c.Bastion
+		if len(c.Tunnels) > 0 {
+			secondary += ", tunnels " + strings.Join(c.Tunnels, ", ")
+		}
+		list.AddItem(main, secondary, 0, func() {
+			ui.app.SetRoot(ui.mainFlex, true)
+			ui.switchContext(cfg, c)
+		})
+	}
+	list.SetDoneFunc(func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	list.SetBorder(true)
+	list.SetTitle(" Contexts (Enter to switch, Esc to cancel) ")
+
+	// Center the list
+	height := 2*list.GetItemCount() + 2
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(list, 60, 1, true).
+			AddItem(nil, 0, 1, false), height, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// switchContext makes c the current context, moves the UI to its bastion and
+// opens its tunnels. Tunnels through the previous bastion stay open.
+func (ui *UI) switchContext(cfg *config.Config, c *config.Context) {
+	if c.Err != nil {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: %v[-]", c.Err))
+		return
+	}
+	bastion, err := cfg.GetBastion(c.Bastion)
+	if err != nil {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: %v[-]", err))
+		return
+	}
+	if err := cfg.UseContext(c.Name); err != nil {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: %v[-]", err))
+		return
+	}
+	if err := config.SaveConfig(cfg); err != nil {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: failed to save config: %v[-]", err))
+		return
+	}
+
+	ui.context = c
+	ui.bastion = bastion
+	ui.ports = nil
+	ui.updateHeader()
+	ui.updateTable()
+	ui.statusBar.SetText(fmt.Sprintf("[green]Switched to context '%s'[-]", c.Name))
+
+	if ui.onSwitch != nil {
+		// Restarting discovery may wait on the network, so keep it off the
+		// UI goroutine, and never let an earlier switch run after a later one
+		ui.switchSeq++
+		seq, bastion := ui.switchSeq, ui.bastion
+		go func() {
+			ui.switchMu.Lock()
+			defer ui.switchMu.Unlock()
+			if seq < ui.lastSwitch {
+				return
+			}
+			ui.lastSwitch = seq
+			ui.onSwitch(bastion, c)
+		}()
+	}
+	ui.OpenContext(cfg, c)
+}
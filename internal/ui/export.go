@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/export"
+	"mytunnel/internal/ssh"
+)
+
+// showExport shows the bastion and its open tunnels as a plain ssh command,
+// switching to ssh_config Host blocks and back with 'f'
+func (ui *UI) showExport() {
+	var tunnels []daemon.TunnelInfo
+	for _, tunnel := range ui.listTunnels(ssh.LocalTunnel, ssh.DynamicTunnel, ssh.RemoteTunnel) {
+		if tunnel.Bastion == ui.bastion.Name {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+
+	format := export.CommandFormat
+	text := tview.NewTextView().
+		SetWrap(true).
+		SetScrollable(true)
+	text.SetBorder(true)
+	render := func() {
+		text.SetText(export.Export(format, ui.bastion, tunnels))
+		text.SetTitle(" Export as " + string(format) + " ('f' to switch format, Esc to close) ")
+	}
+	render()
+
+	text.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q':
+			ui.app.SetRoot(ui.mainFlex, true)
+			return nil
+		case event.Rune() == 'f':
+			if format == export.CommandFormat {
+				format = export.SSHConfigFormat
+			} else {
+				format = export.CommandFormat
+			}
+			render()
+			return nil
+		}
+		return event
+	})
+
+	ui.app.SetRoot(text, true)
+}
@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/ssh"
+)
+
+// Autostart opens the autostart profiles of cfg together with the tunnels of
+// the context the UI starts in, if any, in the background. A profile in both
+// is opened once. Failures are reported in the status bar.
+func (ui *UI) Autostart(cfg *config.Config, c *config.Context) {
+	profiles := daemon.AutostartProfiles(cfg)
+	if c != nil {
+		profiles = append(profiles, cfg.ContextTunnels(c)...)
+	}
+	ui.openProfiles(profiles)
+}
+
+// openProfiles opens profiles in the background and reports failures in the
+// status bar
+func (ui *UI) openProfiles(profiles []*config.TunnelProfile) {
+	if len(profiles) == 0 {
+		return
+	}
+	go func() {
+		if err := daemon.OpenProfiles(context.Background(), ui.tunnels, profiles); err != nil {
+			ui.showError(strings.ReplaceAll(err.Error(), "\n", "; "))
+		}
+	}()
+}
+
+// showSaveProfileForm asks for the name of a profile that reopens the
+// selected tunnel
+func (ui *UI) showSaveProfileForm() {
+	tunnel, ok := ui.selectedTunnel()
+	if !ok {
+		return
+	}
+
+	form := tview.NewForm()
+	form.AddInputField("Name", fmt.Sprintf("%s-%d", tunnel.Bastion, tunnel.Port()), 30, nil, nil)
+	form.AddInputField("Label", "", 30, nil, nil)
+	form.AddCheckbox("Autostart", false, nil)
+	form.AddButton("Save", func() {
+		name := strings.TrimSpace(form.GetFormItem(0).(*tview.InputField).GetText())
+		ui.app.SetRoot(ui.mainFlex, true)
+		if name == "" {
+			ui.statusBar.SetText("[red]Error: a profile name is required[-]")
+			return
+		}
+
+		profile := daemon.NewProfile(tunnel)
+		profile.Label = form.GetFormItem(1).(*tview.InputField).GetText()
+		profile.Autostart = form.GetFormItem(2).(*tview.Checkbox).IsChecked()
+		if err := saveProfile(name, profile); err != nil {
+			ui.statusBar.SetText(fmt.Sprintf("[red]Error: %v[-]", err))
+			return
+		}
+		ui.statusBar.SetText(fmt.Sprintf("[green]Saved %s as tunnel profile '%s'[-]", tunnel.ID, name))
+	})
+	form.AddButton("Cancel", func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	form.SetBorder(true)
+	form.SetTitle(" Save Profile ")
+
+	// Center the form
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 50, 1, true).
+			AddItem(nil, 0, 1, false), 11, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// saveProfile adds a profile to the config file, replacing one with the same name
+func saveProfile(name string, profile *config.TunnelProfile) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ValidateTunnel(name, profile); err != nil {
+		return err
+	}
+	cfg.AddTunnel(name, profile)
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// showProfiles lists the saved profiles and opens the one picked
+func (ui *UI) showProfiles() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: failed to load config: %v[-]", err))
+		return
+	}
+	if len(cfg.Tunnels) == 0 {
+		ui.statusBar.SetText("[yellow]No tunnel profiles saved, press 'p' on a tunnel to save one[-]")
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(true)
+	for _, name := range cfg.TunnelNames() {
+		profile := cfg.Tunnels[name]
+		req, err := daemon.ProfileRequest(profile)
+		if err != nil {
+			continue
+		}
+
+		secondary := fmt.Sprintf("%s via %s", req.Type, profile.Bastion)
+		if profile.Label != "" {
+			secondary += " - " + profile.Label
+		}
+		list.AddItem(name, secondary, 0, func() {
+			ui.app.SetRoot(ui.mainFlex, true)
+			if req.Type == ssh.RemoteTunnel {
+				ui.setView(reverseView)
+			} else {
+				ui.setView(tunnelsView)
+			}
+			ui.openProfile(name, req)
+		})
+	}
+	list.SetDoneFunc(func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	list.SetBorder(true)
+	list.SetTitle(" Profiles (Enter to open, Esc to cancel) ")
+
+	// Center the list
+	height := 2*list.GetItemCount() + 2
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(list, 60, 1, true).
+			AddItem(nil, 0, 1, false), height, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// openProfile opens a saved profile, which may use another bastion than the UI's
+func (ui *UI) openProfile(name string, req daemon.OpenRequest) {
+	go func() {
+		tunnel, err := ui.tunnels.Open(context.Background(), req)
+		if err != nil {
+			ui.showError(fmt.Sprintf("Failed to open profile '%s': %v", name, err))
+			return
+		}
+		ui.app.QueueUpdateDraw(func() {
+			ui.statusBar.SetText(fmt.Sprintf("[green]Opened profile '%s' as %s[-]", name, tunnel.ID))
+		})
+	}()
+}
@@ -1,262 +1,956 @@
-package ui
-
-import (
-	"fmt"
-	"strconv"
-	"strings"
-
-	"github.com/gdamore/tcell/v2"
-	"github.com/rivo/tview"
-	"mytunnel/internal/config"
-	"mytunnel/internal/ssh"
-)
-
-// UI represents the terminal user interface
-type UI struct {
-	app           *tview.Application
-	table         *tview.Table
-	statusBar     *tview.TextView
-	tunnelManager *ssh.TunnelManager
-	bastion       *config.BastionConfig
-	ports         []int
-	filter        string
-	mainFlex      *tview.Flex // Add this field to store the main layout
-}
-
-// NewUI creates a new terminal UI
-func NewUI(tunnelManager *ssh.TunnelManager, bastion *config.BastionConfig) *UI {
-	ui := &UI{
-		app:           tview.NewApplication(),
-		tunnelManager: tunnelManager,
-		bastion:       bastion,
-		ports:         make([]int, 0),
-	}
-
-	ui.setupUI()
-	return ui
-}
-
-// setupUI initializes the UI components
-func (ui *UI) setupUI() {
-	// Create main table
-	ui.table = tview.NewTable().
-		SetBorders(true).
-		SetSelectable(true, false)
-
-	// Create status bar
-	ui.statusBar = tview.NewTextView().
-		SetDynamicColors(true).
-		SetText("Press '?' for help")
-
-	// Create layout
-	ui.mainFlex = tview.NewFlex().
-		SetDirection(tview.FlexRow).
-		AddItem(ui.table, 0, 1, true).
-		AddItem(ui.statusBar, 1, 1, false)
-
-	// Set up key bindings
-	ui.app.SetInputCapture(ui.handleInput)
-
-	// Set up table headers
-	ui.table.SetCell(0, 0, tview.NewTableCell("Local Port").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-	ui.table.SetCell(0, 1, tview.NewTableCell("Remote Port").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-	ui.table.SetCell(0, 2, tview.NewTableCell("Status").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-
-	ui.app.SetRoot(ui.mainFlex, true)
-}
-
-// handleInput processes keyboard input
-func (ui *UI) handleInput(event *tcell.EventKey) *tcell.EventKey {
-	switch event.Key() {
-	case tcell.KeyEscape:
-		ui.app.Stop()
-		return nil
-	case tcell.KeyRune:
-		switch event.Rune() {
-		case 'q':
-			ui.app.Stop()
-			return nil
-		case 'j':
-			row, _ := ui.table.GetSelection()
-			if row < ui.table.GetRowCount()-1 {
-				ui.table.Select(row+1, 0)
-			}
-			return nil
-		case 'k':
-			row, _ := ui.table.GetSelection()
-			if row > 1 {
-				ui.table.Select(row-1, 0)
-			}
-			return nil
-		case '/':
-			ui.showFilterPrompt()
-			return nil
-		case 't':
-			ui.toggleTunnelView()
-			return nil
-		case 'd':
-			ui.closeTunnel()
-			return nil
-		case '?':
-			ui.showHelp()
-			return nil
-		case ' ', '\r':
-			ui.openTunnel()
-			return nil
-		}
-	}
-	return event
-}
-
-// showFilterPrompt shows a prompt for filtering ports
-func (ui *UI) showFilterPrompt() {
-	form := tview.NewForm()
-	form.AddInputField("Filter", "", 30, nil, func(text string) {
-		ui.filter = text
-		ui.updateTable()
-		ui.app.SetRoot(ui.mainFlex, true)
-	})
-	form.AddButton("Cancel", func() {
-		ui.app.SetRoot(ui.mainFlex, true)
-	})
-	form.SetBorder(true)
-	form.SetTitle(" Filter Ports ")
-	
-	// Center the form
-	flex := tview.NewFlex().
-		AddItem(nil, 0, 1, false).
-		AddItem(tview.NewFlex().
-			AddItem(nil, 0, 1, false).
-			AddItem(form, 40, 1, true).
-			AddItem(nil, 0, 1, false), 3, 1, true).
-		AddItem(nil, 0, 1, false)
-		
-	ui.app.SetRoot(flex, true)
-}
-
-// toggleTunnelView switches between available ports and active tunnels
-func (ui *UI) toggleTunnelView() {
-	// Implementation depends on how you want to display active tunnels
-	tunnels := ui.tunnelManager.ListTunnels()
-	ui.table.Clear()
-
-	// Redraw headers
-	ui.table.SetCell(0, 0, tview.NewTableCell("Local Port").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-	ui.table.SetCell(0, 1, tview.NewTableCell("Remote Port").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-	ui.table.SetCell(0, 2, tview.NewTableCell("Status").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-
-	for i, tunnel := range tunnels {
-		ui.table.SetCell(i+1, 0, tview.NewTableCell(fmt.Sprintf("%d", tunnel.LocalPort)))
-		ui.table.SetCell(i+1, 1, tview.NewTableCell(fmt.Sprintf("%d", tunnel.RemotePort)))
-		ui.table.SetCell(i+1, 2, tview.NewTableCell("Active").SetTextColor(tcell.ColorGreen))
-	}
-}
-
-// openTunnel opens a new SSH tunnel for the selected port
-func (ui *UI) openTunnel() {
-	row, _ := ui.table.GetSelection()
-	if row <= 0 {
-		return
-	}
-
-	localPortStr := ui.table.GetCell(row, 0).Text
-	remotePortStr := ui.table.GetCell(row, 1).Text
-
-	localPort, _ := strconv.Atoi(localPortStr)
-	remotePort, _ := strconv.Atoi(remotePortStr)
-
-	go func() {
-		if err := ui.tunnelManager.CreateTunnel(localPort, remotePort, ui.bastion); err != nil {
-			ui.showError(fmt.Sprintf("Failed to create tunnel: %v", err))
-			return
-		}
-		ui.app.QueueUpdateDraw(func() {
-			ui.table.GetCell(row, 2).SetText("Active").SetTextColor(tcell.ColorGreen)
-		})
-	}()
-}
-
-// closeTunnel closes the selected tunnel
-func (ui *UI) closeTunnel() {
-	row, _ := ui.table.GetSelection()
-	if row <= 0 {
-		return
-	}
-
-	localPortStr := ui.table.GetCell(row, 0).Text
-	localPort, _ := strconv.Atoi(localPortStr)
-
-	if err := ui.tunnelManager.CloseTunnel(localPort); err != nil {
-		ui.showError(fmt.Sprintf("Failed to close tunnel: %v", err))
-		return
-	}
-
-	ui.table.GetCell(row, 2).SetText("Closed").SetTextColor(tcell.ColorRed)
-}
-
-// showError displays an error message in the status bar
-func (ui *UI) showError(msg string) {
-	ui.app.QueueUpdateDraw(func() {
-		ui.statusBar.SetText(fmt.Sprintf("[red]Error: %s[-]", msg))
-	})
-}
-
-// showHelp displays the help dialog
-func (ui *UI) showHelp() {
-	text := `
-[yellow]Keyboard Controls:[-]
-j/k - Navigate up/down
-Enter/Space - Open tunnel
-t - Toggle tunnel view
-d - Close tunnel
-/ - Filter ports
-q/Esc - Quit
-? - Show this help
-`
-	modal := tview.NewModal().
-		SetText(text).
-		AddButtons([]string{"OK"}).
-		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-			ui.app.SetRoot(ui.mainFlex, true)
-		})
-
-	ui.app.SetRoot(modal, true)
-}
-
-// updateTable updates the table with filtered ports
-func (ui *UI) updateTable() {
-	ui.table.Clear()
-
-	// Set headers
-	ui.table.SetCell(0, 0, tview.NewTableCell("Local Port").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-	ui.table.SetCell(0, 1, tview.NewTableCell("Remote Port").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-	ui.table.SetCell(0, 2, tview.NewTableCell("Status").SetSelectable(false).SetTextColor(tcell.ColorYellow))
-
-	row := 1
-	for _, port := range ui.ports {
-		if ui.filter != "" && !strings.Contains(fmt.Sprintf("%d", port), ui.filter) {
-			continue
-		}
-
-		ui.table.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d", port)))
-		ui.table.SetCell(row, 1, tview.NewTableCell(fmt.Sprintf("%d", port)))
-		ui.table.SetCell(row, 2, tview.NewTableCell("Available").SetTextColor(tcell.ColorWhite))
-		row++
-	}
-}
-
-// Run starts the UI
-func (ui *UI) Run() error {
-	return ui.app.Run()
-}
-
-// Stop stops the UI
-func (ui *UI) Stop() {
-	ui.app.Stop()
-}
-
-// SetPorts updates the available ports list
-func (ui *UI) SetPorts(ports []int) {
-	ui.ports = ports
-	ui.updateTable()
-} 
\ No newline at end of file
+package ui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"mytunnel/internal/config"
+	"mytunnel/internal/daemon"
+	"mytunnel/internal/logging"
+	"mytunnel/internal/ssh"
+)
+
+const (
+	// statsRefreshInterval is how often the tunnel views are redrawn
+	statsRefreshInterval = time.Second
+	// logViewHeight is the height of the log pane when shown
+	logViewHeight = 12
+	// expiryWarning is how close to its expiry a tunnel is highlighted
+	expiryWarning = 5 * time.Minute
+	// requestTimeout bounds quick requests such as listing or closing tunnels
+	requestTimeout = 2 * time.Second
+)
+
+// viewMode is the content currently shown in the main table
+type viewMode int
+
+const (
+	portsView viewMode = iota
+	tunnelsView
+	reverseView
+)
+
+// UI represents the terminal user interface
+type UI struct {
+	app       *tview.Application
+	table     *tview.Table
+	header    *tview.TextView
+	logView   *tview.TextView
+	statusBar *tview.TextView
+	logs      logging.Source
+	showLogs  bool
+	tunnels   daemon.Controller
+	bastion   *config.BastionConfig
+	context   *config.Context
+	ports     []ssh.ListeningPort
+	filter    string
+	view      viewMode
+	mainFlex  *tview.Flex // Add this field to store the main layout
+
+	// onSwitch restarts port discovery after a context switch. switchSeq
+	// counts switches on the UI goroutine; lastSwitch is the latest one
+	// handed to onSwitch, guarded by switchMu.
+	onSwitch   func(*config.BastionConfig, *config.Context)
+	switchSeq  int
+	lastSwitch int
+	switchMu   sync.Mutex
+
+	// done is closed once the UI has stopped running
+	done chan struct{}
+	// tunnelList is the last tunnel list fetched by watchTunnels, and refresh
+	// asks it for a new one. The controller may be a remote daemon, so it is
+	// never queried from the UI goroutine.
+	tunnelList []daemon.TunnelInfo
+	refresh    chan struct{}
+	// loadingLogs is set while log entries are being fetched
+	loadingLogs bool
+}
+
+// NewUI creates a new terminal UI that manages tunnels through a controller,
+// either in this process or in a running daemon
+func NewUI(tunnels daemon.Controller, bastion *config.BastionConfig) *UI {
+	ui := &UI{
+		app:     tview.NewApplication(),
+		tunnels: tunnels,
+		bastion: bastion,
+		ports:   make([]ssh.ListeningPort, 0),
+		done:    make(chan struct{}),
+		refresh: make(chan struct{}, 1),
+	}
+
+	ui.setupUI()
+	return ui
+}
+
+// setupUI initializes the UI components
+func (ui *UI) setupUI() {
+	// Create main table
+	ui.table = tview.NewTable().
+		SetBorders(true).
+		SetSelectable(true, false)
+
+	// Create header with the bastion route
+	ui.header = tview.NewTextView().
+		SetDynamicColors(true)
+	ui.updateHeader()
+
+	// Create log pane, hidden until toggled
+	ui.logView = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	ui.logView.SetBorder(true)
+
+	// Create status bar
+	ui.statusBar = tview.NewTextView().
+		SetDynamicColors(true).
+		SetText("Press '?' for help")
+
+	// Create layout
+	ui.mainFlex = tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(ui.header, 1, 1, false).
+		AddItem(ui.table, 0, 1, true).
+		AddItem(ui.logView, 0, 0, false).
+		AddItem(ui.statusBar, 1, 1, false)
+
+	// Set up key bindings
+	ui.app.SetInputCapture(ui.handleInput)
+
+	// Follow the selected tunnel in the log pane
+	ui.table.SetSelectionChangedFunc(func(row, column int) {
+		if ui.showLogs {
+			ui.updateLogView()
+		}
+	})
+
+	// Set up table headers
+	ui.updateTable()
+
+	ui.app.SetRoot(ui.mainFlex, true)
+}
+
+// updateHeader shows the current context and bastion route
+func (ui *UI) updateHeader() {
+	text := fmt.Sprintf("[yellow]Bastion:[-] %s [gray](%s@%s:%d)[-]",
+		ui.bastion.RouteString(), ui.bastion.User, ui.bastion.Host, ui.bastion.Port)
+	if ui.context != nil {
+		text = fmt.Sprintf("[yellow]Context:[-] %s  ", ui.context.Name) + text
+	}
+	ui.header.SetText(text)
+}
+
+// handleInput processes keyboard input
+func (ui *UI) handleInput(event *tcell.EventKey) *tcell.EventKey {
+	// Leave keys to dialogs and forms while they have focus
+	if ui.app.GetFocus() != ui.table {
+		return event
+	}
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		ui.app.Stop()
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'q':
+			ui.app.Stop()
+			return nil
+		case 'j':
+			row, _ := ui.table.GetSelection()
+			if row < ui.table.GetRowCount()-1 {
+				ui.table.Select(row+1, 0)
+			}
+			return nil
+		case 'k':
+			row, _ := ui.table.GetSelection()
+			if row > 1 {
+				ui.table.Select(row-1, 0)
+			}
+			return nil
+		case '/':
+			ui.showFilterPrompt()
+			return nil
+		case 't':
+			ui.toggleTunnelView()
+			return nil
+		case 'r':
+			ui.toggleReverseView()
+			return nil
+		case 'a':
+			ui.showReverseTunnelForm()
+			return nil
+		case 's':
+			ui.showDynamicTunnelForm()
+			return nil
+		case 'd':
+			ui.closeTunnel()
+			return nil
+		case '?':
+			ui.showHelp()
+			return nil
+		case 'n':
+			ui.showTunnelForm()
+			return nil
+		case 'l':
+			ui.toggleLogView()
+			return nil
+		case 'e':
+			ui.extendTunnel()
+			return nil
+		case 'p':
+			ui.showSaveProfileForm()
+			return nil
+		case 'o':
+			ui.showProfiles()
+			return nil
+		case 'x':
+			ui.showExport()
+			return nil
+		case 'c':
+			ui.showContexts()
+			return nil
+		case ' ', '\r':
+			if ui.view == portsView {
+				ui.openTunnel()
+			}
+			return nil
+		}
+	}
+	return event
+}
+
+// showFilterPrompt shows a prompt for filtering ports
+func (ui *UI) showFilterPrompt() {
+	form := tview.NewForm()
+	form.AddInputField("Filter", "", 30, nil, func(text string) {
+		ui.filter = text
+		ui.updateTable()
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	form.AddButton("Cancel", func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	form.SetBorder(true)
+	form.SetTitle(" Filter Ports ")
+
+	// Center the form
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 40, 1, true).
+			AddItem(nil, 0, 1, false), 3, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// toggleTunnelView switches between available ports and active tunnels
+func (ui *UI) toggleTunnelView() {
+	if ui.view == tunnelsView {
+		ui.setView(portsView)
+	} else {
+		ui.setView(tunnelsView)
+	}
+}
+
+// toggleReverseView switches between available ports and reverse tunnels
+func (ui *UI) toggleReverseView() {
+	if ui.view == reverseView {
+		ui.setView(portsView)
+	} else {
+		ui.setView(reverseView)
+	}
+}
+
+// setView changes the content of the main table
+func (ui *UI) setView(view viewMode) {
+	ui.view = view
+	ui.updateTable()
+	ui.table.Select(1, 0)
+}
+
+// showReverseTunnelForm asks for the ports of a new reverse tunnel
+func (ui *UI) showReverseTunnelForm() {
+	form := tview.NewForm()
+	form.AddInputField("Remote Port (0 = any)", "0", 10, tview.InputFieldInteger, nil)
+	form.AddInputField("Local Port", "", 10, tview.InputFieldInteger, nil)
+	form.AddButton("Open", func() {
+		remotePort, _ := strconv.Atoi(form.GetFormItem(0).(*tview.InputField).GetText())
+		localPort, err := strconv.Atoi(form.GetFormItem(1).(*tview.InputField).GetText())
+		ui.app.SetRoot(ui.mainFlex, true)
+		if err != nil || localPort <= 0 {
+			ui.statusBar.SetText("[red]Error: a local port is required[-]")
+			return
+		}
+		ui.setView(reverseView)
+		ui.openReverseTunnel(remotePort, localPort)
+	})
+	form.AddButton("Cancel", func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	form.SetBorder(true)
+	form.SetTitle(" Reverse Tunnel ")
+
+	// Center the form
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 40, 1, true).
+			AddItem(nil, 0, 1, false), 9, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// showDynamicTunnelForm asks for the local port of a new SOCKS proxy
+func (ui *UI) showDynamicTunnelForm() {
+	form := tview.NewForm()
+	form.AddInputField("Local Port", "1080", 10, tview.InputFieldInteger, nil)
+	form.AddButton("Open", func() {
+		localPort, err := strconv.Atoi(form.GetFormItem(0).(*tview.InputField).GetText())
+		ui.app.SetRoot(ui.mainFlex, true)
+		if err != nil || localPort <= 0 {
+			ui.statusBar.SetText("[red]Error: a local port is required[-]")
+			return
+		}
+		ui.setView(tunnelsView)
+		ui.openDynamicTunnel(localPort)
+	})
+	form.AddButton("Cancel", func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	form.SetBorder(true)
+	form.SetTitle(" SOCKS Proxy ")
+
+	// Center the form
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 40, 1, true).
+			AddItem(nil, 0, 1, false), 7, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// openDynamicTunnel starts a SOCKS proxy through the bastion
+func (ui *UI) openDynamicTunnel(localPort int) {
+	ui.open(daemon.OpenRequest{
+		Type:      ssh.DynamicTunnel,
+		LocalPort: localPort,
+	}, func(tunnel daemon.TunnelInfo) string {
+		return fmt.Sprintf("SOCKS proxy listening on localhost:%d", tunnel.LocalPort)
+	})
+}
+
+// openReverseTunnel exposes a local port on the bastion
+func (ui *UI) openReverseTunnel(remotePort, localPort int) {
+	ui.open(daemon.OpenRequest{
+		Type:       ssh.RemoteTunnel,
+		LocalPort:  localPort,
+		RemotePort: remotePort,
+	}, func(tunnel daemon.TunnelInfo) string {
+		return fmt.Sprintf("Bastion port %d now forwards to local port %d", tunnel.RemotePort, tunnel.LocalPort)
+	})
+}
+
+// open creates a tunnel on the current bastion in the background and reports
+// the outcome in the status bar
+func (ui *UI) open(req daemon.OpenRequest, success func(daemon.TunnelInfo) string) {
+	req.Bastion = ui.bastion.Name
+	go func() {
+		tunnel, err := ui.tunnels.Open(context.Background(), req)
+		if err != nil {
+			ui.showError(fmt.Sprintf("Failed to create %s tunnel: %v", req.Type, err))
+			return
+		}
+		if success == nil {
+			return
+		}
+		ui.app.QueueUpdateDraw(func() {
+			ui.statusBar.SetText(fmt.Sprintf("[green]%s[-]", success(tunnel)))
+		})
+	}()
+}
+
+// openTunnel opens a new SSH tunnel for the selected port
+func (ui *UI) openTunnel() {
+	row, _ := ui.table.GetSelection()
+	if row <= 0 {
+		return
+	}
+
+	localPortStr := ui.table.GetCell(row, 0).Text
+	remotePortStr := ui.table.GetCell(row, 1).Text
+
+	localPort, _ := strconv.Atoi(localPortStr)
+	remotePort, _ := strconv.Atoi(remotePortStr)
+
+	// A service bound to one specific interface isn't reachable through localhost
+	remoteHost := ""
+	if address := ui.table.GetCell(row, 2).Text; !isWildcardOrLoopback(address) {
+		remoteHost = address
+	}
+
+	ui.createTunnel(localPort, remoteHost, remotePort, nil)
+}
+
+// createTunnel opens a tunnel in the background. Limits override the bastion's
+// idle timeout and max lifetime when not nil.
+func (ui *UI) createTunnel(localPort int, remoteHost string, remotePort int, limits *ssh.TunnelLimits) {
+	ui.open(daemon.OpenRequest{
+		Type:       ssh.LocalTunnel,
+		LocalPort:  localPort,
+		RemoteHost: remoteHost,
+		RemotePort: remotePort,
+		Limits:     limits,
+	}, nil)
+}
+
+// isWildcardOrLoopback reports whether a bind address is reachable as localhost
+func isWildcardOrLoopback(address string) bool {
+	if address == "*" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip == nil || ip.IsUnspecified() || ip.IsLoopback()
+}
+
+// showTunnelForm asks for the local port and host:port target of a new tunnel
+func (ui *UI) showTunnelForm() {
+	form := tview.NewForm()
+	form.AddInputField("Local Port", "", 10, tview.InputFieldInteger, nil)
+	form.AddInputField("Target (host:port)", "", 30, nil, nil)
+	form.AddInputField("Idle Timeout", formatLimit(ui.bastion.IdleTimeout), 10, nil, nil)
+	form.AddInputField("Max Lifetime", formatLimit(ui.bastion.MaxLifetime), 10, nil, nil)
+	form.AddButton("Open", func() {
+		localPort, err := strconv.Atoi(form.GetFormItem(0).(*tview.InputField).GetText())
+		target := form.GetFormItem(1).(*tview.InputField).GetText()
+		ui.app.SetRoot(ui.mainFlex, true)
+		if err != nil || localPort <= 0 {
+			ui.statusBar.SetText("[red]Error: a local port is required[-]")
+			return
+		}
+		remoteHost, remotePort, err := ssh.ParseHostPort(target)
+		if err != nil {
+			ui.statusBar.SetText(fmt.Sprintf("[red]Error: %v[-]", err))
+			return
+		}
+		idleTimeout, err := parseLimit(form.GetFormItem(2).(*tview.InputField).GetText())
+		if err != nil {
+			ui.statusBar.SetText(fmt.Sprintf("[red]Error: invalid idle timeout: %v[-]", err))
+			return
+		}
+		maxLifetime, err := parseLimit(form.GetFormItem(3).(*tview.InputField).GetText())
+		if err != nil {
+			ui.statusBar.SetText(fmt.Sprintf("[red]Error: invalid max lifetime: %v[-]", err))
+			return
+		}
+		ui.setView(tunnelsView)
+		ui.createTunnel(localPort, remoteHost, remotePort, &ssh.TunnelLimits{
+			IdleTimeout: idleTimeout,
+			MaxLifetime: maxLifetime,
+		})
+	})
+	form.AddButton("Cancel", func() {
+		ui.app.SetRoot(ui.mainFlex, true)
+	})
+	form.SetBorder(true)
+	form.SetTitle(" New Tunnel ")
+
+	// Center the form
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 56, 1, true).
+			AddItem(nil, 0, 1, false), 13, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.app.SetRoot(flex, true)
+}
+
+// extendTunnel pushes back the expiry of the selected tunnel
+func (ui *UI) extendTunnel() {
+	tunnel, ok := ui.selectedTunnel()
+	if !ok {
+		return
+	}
+	if tunnel.ExpiresAt.IsZero() {
+		ui.statusBar.SetText(fmt.Sprintf("[yellow]%s has no idle timeout or max lifetime[-]", tunnel.ID))
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		tunnel, err := ui.tunnels.Extend(ctx, tunnel.ID)
+		if err != nil {
+			ui.showError(fmt.Sprintf("Failed to extend tunnel: %v", err))
+			return
+		}
+		ui.app.QueueUpdateDraw(func() {
+			ui.statusBar.SetText(fmt.Sprintf("[green]%s extended, now expires in %s[-]", tunnel.ID, formatUntil(tunnel.ExpiresAt)))
+		})
+		ui.refreshTunnels()
+	}()
+}
+
+// closeTunnel closes the selected tunnel
+func (ui *UI) closeTunnel() {
+	tunnel, ok := ui.selectedTunnel()
+	if !ok {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		if err := ui.tunnels.Close(ctx, tunnel.ID); err != nil {
+			ui.showError(fmt.Sprintf("Failed to close tunnel: %v", err))
+		}
+	}()
+}
+
+// showError displays an error message in the status bar
+func (ui *UI) showError(msg string) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.statusBar.SetText(fmt.Sprintf("[red]Error: %s[-]", msg))
+	})
+}
+
+// ConfirmHostKey asks the user whether to trust an unknown host key.
+// It blocks until the user answers and must not be called from the UI goroutine.
+// A prompt still open when the UI stops counts as a rejection.
+func (ui *UI) ConfirmHostKey(hostname, keyType, fingerprint string) bool {
+	answer := make(chan bool, 1)
+
+	ui.app.QueueUpdateDraw(func() {
+		text := fmt.Sprintf("The authenticity of host '%s' can't be established.\n\n%s key fingerprint is\n%s\n\nDo you want to trust this host?",
+			hostname, keyType, fingerprint)
+		modal := tview.NewModal().
+			SetText(text).
+			AddButtons([]string{"Accept", "Reject"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				answer <- buttonLabel == "Accept"
+				ui.app.SetRoot(ui.mainFlex, true)
+			})
+		ui.app.SetRoot(modal, true)
+	})
+
+	select {
+	case accepted := <-answer:
+		return accepted
+	case <-ui.done:
+		return false
+	}
+}
+
+// showHelp displays the help dialog
+func (ui *UI) showHelp() {
+	text := `
+[yellow]Keyboard Controls:[-]
+j/k - Navigate up/down
+Enter/Space - Open tunnel
+t - Toggle tunnel view
+r - Toggle reverse tunnel view
+a - Add reverse tunnel
+n - New tunnel to any host:port
+l - Toggle log pane (filtered by selected tunnel)
+e - Extend the selected tunnel's expiry
+p - Save the selected tunnel as a profile
+o - Open a saved profile
+x - Export as an ssh command or ssh_config
+c - Switch context
+s - Start SOCKS proxy
+d - Close tunnel
+/ - Filter ports
+q/Esc - Quit
+? - Show this help
+`
+	modal := tview.NewModal().
+		SetText(text).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.app.SetRoot(ui.mainFlex, true)
+		})
+
+	ui.app.SetRoot(modal, true)
+}
+
+// setHeaders clears the table and writes the header row
+func (ui *UI) setHeaders(headers ...string) {
+	ui.table.Clear()
+	for i, header := range headers {
+		ui.table.SetCell(0, i, tview.NewTableCell(header).SetSelectable(false).SetTextColor(tcell.ColorYellow))
+	}
+}
+
+// updateTable redraws the table for the current view
+func (ui *UI) updateTable() {
+	switch ui.view {
+	case tunnelsView:
+		ui.updateTunnelTable()
+	case reverseView:
+		ui.updateReverseTable()
+	default:
+		ui.updatePortTable()
+	}
+}
+
+// updatePortTable updates the table with filtered ports
+func (ui *UI) updatePortTable() {
+	ui.setHeaders("Local Port", "Remote Port", "Bind Address", "Status")
+
+	active := make(map[string]daemon.TunnelInfo)
+	for _, tunnel := range ui.listTunnels(ssh.LocalTunnel) {
+		if tunnel.Bastion == ui.bastion.Name {
+			active[net.JoinHostPort(tunnel.RemoteHost, strconv.Itoa(tunnel.RemotePort))] = tunnel
+		}
+	}
+
+	row := 1
+	for _, port := range ui.ports {
+		if ui.filter != "" &&
+			!strings.Contains(fmt.Sprintf("%d", port.Port), ui.filter) &&
+			!strings.Contains(port.Address, ui.filter) {
+			continue
+		}
+
+		ui.table.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d", port.Port)))
+		ui.table.SetCell(row, 1, tview.NewTableCell(fmt.Sprintf("%d", port.Port)))
+		ui.table.SetCell(row, 2, tview.NewTableCell(port.Address))
+		target := "localhost"
+		if !isWildcardOrLoopback(port.Address) {
+			target = port.Address
+		}
+		if tunnel, ok := active[net.JoinHostPort(target, strconv.Itoa(port.Port))]; ok {
+			ui.table.SetCell(row, 3, statusCell(tunnel))
+		} else {
+			ui.table.SetCell(row, 3, tview.NewTableCell("Available").SetTextColor(tcell.ColorWhite))
+		}
+		row++
+	}
+}
+
+// updateTunnelTable updates the table with active tunnels
+func (ui *UI) updateTunnelTable() {
+	ui.setHeaders("Local Port", "Remote", "Type", "Bastion", "Status", "Expires", "In", "Out", "Conns", "Errors", "Last Activity")
+
+	tunnels := ui.listTunnels(ssh.LocalTunnel, ssh.DynamicTunnel)
+	sort.Slice(tunnels, func(i, j int) bool {
+		return tunnels[i].LocalPort < tunnels[j].LocalPort
+	})
+
+	for i, tunnel := range tunnels {
+		remote := net.JoinHostPort(tunnel.RemoteHost, strconv.Itoa(tunnel.RemotePort))
+		if tunnel.Type == ssh.DynamicTunnel {
+			remote = "*"
+		}
+		ui.table.SetCell(i+1, 0, tview.NewTableCell(fmt.Sprintf("%d", tunnel.LocalPort)))
+		ui.table.SetCell(i+1, 1, tview.NewTableCell(remote))
+		ui.table.SetCell(i+1, 2, tview.NewTableCell(tunnel.Type.String()))
+		ui.table.SetCell(i+1, 3, tview.NewTableCell(tunnel.Bastion))
+		ui.table.SetCell(i+1, 4, statusCell(tunnel))
+		ui.table.SetCell(i+1, 5, expiryCell(tunnel))
+		ui.setStatsCells(i+1, 6, tunnel)
+	}
+}
+
+// updateReverseTable updates the table with reverse tunnels
+func (ui *UI) updateReverseTable() {
+	ui.setHeaders("Remote Port", "Local Port", "Bastion", "Status", "Expires", "In", "Out", "Conns", "Errors", "Last Activity")
+
+	for i, tunnel := range ui.listTunnels(ssh.RemoteTunnel) {
+		ui.table.SetCell(i+1, 0, tview.NewTableCell(fmt.Sprintf("%d", tunnel.RemotePort)))
+		ui.table.SetCell(i+1, 1, tview.NewTableCell(fmt.Sprintf("%d", tunnel.LocalPort)))
+		ui.table.SetCell(i+1, 2, tview.NewTableCell(tunnel.Bastion))
+		ui.table.SetCell(i+1, 3, statusCell(tunnel))
+		ui.table.SetCell(i+1, 4, expiryCell(tunnel))
+		ui.setStatsCells(i+1, 5, tunnel)
+	}
+}
+
+// listTunnels returns the cached tunnels of the given types. It must be
+// called from the UI goroutine.
+func (ui *UI) listTunnels(types ...ssh.TunnelType) []daemon.TunnelInfo {
+	var filtered []daemon.TunnelInfo
+	for _, tunnel := range ui.tunnelList {
+		for _, t := range types {
+			if tunnel.Type == t {
+				filtered = append(filtered, tunnel)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// setStatsCells writes the traffic counters of a tunnel starting at column col
+func (ui *UI) setStatsCells(row, col int, tunnel daemon.TunnelInfo) {
+	stats := tunnel.Stats
+	ui.table.SetCell(row, col, tview.NewTableCell(formatBytes(stats.BytesIn)))
+	ui.table.SetCell(row, col+1, tview.NewTableCell(formatBytes(stats.BytesOut)))
+	ui.table.SetCell(row, col+2, tview.NewTableCell(fmt.Sprintf("%d/%d", stats.ActiveConns, stats.TotalConns)))
+
+	errors := tview.NewTableCell(fmt.Sprintf("%d", stats.DialErrors))
+	if stats.DialErrors > 0 {
+		errors.SetTextColor(tcell.ColorRed)
+	}
+	ui.table.SetCell(row, col+3, errors)
+	ui.table.SetCell(row, col+4, tview.NewTableCell(formatSince(stats.LastActivity)))
+}
+
+// statusCell renders the state of a tunnel
+func statusCell(tunnel daemon.TunnelInfo) *tview.TableCell {
+	text := tunnel.State.String()
+	if tunnel.State == ssh.StateReconnecting {
+		text = fmt.Sprintf("%s (%d)", text, tunnel.Retries)
+	}
+	return tview.NewTableCell(text).SetTextColor(stateColor(tunnel.State))
+}
+
+// expiryCell renders the countdown until a tunnel is closed by its limits
+func expiryCell(tunnel daemon.TunnelInfo) *tview.TableCell {
+	if tunnel.ExpiresAt.IsZero() {
+		return tview.NewTableCell("-")
+	}
+
+	cell := tview.NewTableCell(fmt.Sprintf("%s (%s)", formatUntil(tunnel.ExpiresAt), tunnel.ExpiryReason))
+	if time.Until(tunnel.ExpiresAt) < expiryWarning {
+		cell.SetTextColor(tcell.ColorYellow)
+	}
+	return cell
+}
+
+// stateColor returns the color a tunnel state is drawn in
+func stateColor(state ssh.TunnelState) tcell.Color {
+	switch state {
+	case ssh.StateListening:
+		return tcell.ColorGreen
+	case ssh.StateDegraded, ssh.StateReconnecting, ssh.StatePending, ssh.StateConnecting:
+		return tcell.ColorYellow
+	case ssh.StateFailed:
+		return tcell.ColorRed
+	default:
+		return tcell.ColorGray
+	}
+}
+
+// Run starts the UI
+func (ui *UI) Run() error {
+	defer close(ui.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ui.watchTunnels(ctx.Done())
+
+	events, err := ui.tunnels.Events(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to tunnel events: %w", err)
+	}
+	go ui.handleEvents(events)
+
+	return ui.app.Run()
+}
+
+// handleEvents redraws the table whenever a tunnel changes
+func (ui *UI) handleEvents(events <-chan daemon.EventInfo) {
+	for event := range events {
+		// Per-connection events are covered by the periodic stats refresh
+		if event.Type == ssh.EventConnectionAccepted || event.Type == ssh.EventConnectionClosed {
+			continue
+		}
+
+		event := event
+		ui.app.QueueUpdateDraw(func() {
+			switch event.Type {
+			case ssh.EventError:
+				ui.statusBar.SetText(fmt.Sprintf("[red]Error: %s %s: %s[-]", event.Tunnel, event.Message, event.Error))
+			case ssh.EventReconnecting:
+				ui.statusBar.SetText(fmt.Sprintf("[yellow]%s lost its bastion connection, reconnecting (attempt %d)[-]", event.Tunnel, event.Attempt))
+			case ssh.EventExpired:
+				ui.statusBar.SetText(fmt.Sprintf("[yellow]%s closed: %s[-]", event.Tunnel, event.Message))
+			case ssh.EventConnected:
+				if event.Attempt > 0 {
+					ui.statusBar.SetText(fmt.Sprintf("[green]%s reconnected[-]", event.Tunnel))
+				}
+			}
+		})
+		ui.refreshTunnels()
+	}
+}
+
+// refreshTunnels asks watchTunnels to fetch the tunnel list right away. It
+// never blocks and may be called from any goroutine.
+func (ui *UI) refreshTunnels() {
+	select {
+	case ui.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// watchTunnels fetches the tunnel list every second, and whenever
+// refreshTunnels asks for it, then redraws so counters stay live
+func (ui *UI) watchTunnels(done <-chan struct{}) {
+	ticker := time.NewTicker(statsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		tunnels, err := ui.tunnels.List(ctx)
+		cancel()
+
+		ui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				ui.statusBar.SetText(fmt.Sprintf("[red]Error: failed to list tunnels: %v[-]", err))
+			} else {
+				ui.tunnelList = tunnels
+			}
+			ui.updateTable()
+			if ui.showLogs {
+				ui.updateLogView()
+			}
+		})
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		case <-ui.refresh:
+		}
+	}
+}
+
+// Stop stops the UI
+func (ui *UI) Stop() {
+	ui.app.Stop()
+}
+
+// SetStatus replaces the text of the status bar. It must not be called while
+// the UI is running.
+func (ui *UI) SetStatus(text string) {
+	ui.statusBar.SetText(text)
+}
+
+// SetLogs sets the source of recent log entries shown in the log pane
+func (ui *UI) SetLogs(logs logging.Source) {
+	ui.logs = logs
+}
+
+// toggleLogView shows or hides the log pane
+func (ui *UI) toggleLogView() {
+	ui.showLogs = !ui.showLogs
+	if ui.showLogs {
+		ui.mainFlex.ResizeItem(ui.logView, logViewHeight, 0)
+		ui.updateLogView()
+	} else {
+		ui.mainFlex.ResizeItem(ui.logView, 0, 0)
+	}
+}
+
+// updateLogView shows the recent log entries for the selected tunnel, or all
+// entries when no tunnel is selected
+func (ui *UI) updateLogView() {
+	if ui.logs == nil {
+		return
+	}
+
+	tunnel := ui.selectedTunnelID()
+	if tunnel == "" {
+		ui.logView.SetTitle(" Logs ")
+	} else {
+		ui.logView.SetTitle(fmt.Sprintf(" Logs: %s ", tunnel))
+	}
+
+	// Entries may come from the daemon, so fetch them in the background
+	if ui.loadingLogs {
+		return
+	}
+	ui.loadingLogs = true
+	go func() {
+		entries := ui.logs.Entries(tunnel)
+		ui.app.QueueUpdateDraw(func() {
+			ui.loadingLogs = false
+			if ui.showLogs && ui.selectedTunnelID() == tunnel {
+				ui.setLogEntries(entries)
+			}
+		})
+	}()
+}
+
+// setLogEntries shows log entries in the log pane
+func (ui *UI) setLogEntries(entries []logging.Entry) {
+	var b strings.Builder
+	for _, entry := range entries {
+		color := "white"
+		switch {
+		case entry.Level >= slog.LevelError:
+			color = "red"
+		case entry.Level >= slog.LevelWarn:
+			color = "yellow"
+		case entry.Level < slog.LevelInfo:
+			color = "gray"
+		}
+		fmt.Fprintf(&b, "[%s]%s[-]\n", color, tview.Escape(entry.String()))
+	}
+	ui.logView.SetText(b.String())
+	ui.logView.ScrollToEnd()
+}
+
+// selectedTunnelID returns the ID of the tunnel on the selected row, if any
+func (ui *UI) selectedTunnelID() string {
+	if tunnel, ok := ui.selectedTunnel(); ok {
+		return tunnel.ID
+	}
+	return ""
+}
+
+// selectedTunnel returns the tunnel on the selected row, if any
+func (ui *UI) selectedTunnel() (daemon.TunnelInfo, bool) {
+	row, _ := ui.table.GetSelection()
+	if row <= 0 || row >= ui.table.GetRowCount() || ui.view == portsView {
+		return daemon.TunnelInfo{}, false
+	}
+
+	port, _ := strconv.Atoi(ui.table.GetCell(row, 0).Text)
+	types := []ssh.TunnelType{ssh.LocalTunnel, ssh.DynamicTunnel}
+	if ui.view == reverseView {
+		types = []ssh.TunnelType{ssh.RemoteTunnel}
+	}
+	for _, tunnel := range ui.listTunnels(types...) {
+		if tunnel.Port() == port {
+			return tunnel, true
+		}
+	}
+	return daemon.TunnelInfo{}, false
+}
+
+// SetPorts updates the available ports list
+func (ui *UI) SetPorts(ports []ssh.ListeningPort) {
+	ui.ports = ports
+	ui.updateTable()
+}
+
+// UpdatePorts updates the available ports list from a background goroutine
+func (ui *UI) UpdatePorts(ports []ssh.ListeningPort, err error) {
+	if err != nil {
+		ui.showError(fmt.Sprintf("Port discovery failed: %v", err))
+		ui.app.QueueUpdateDraw(ui.updateTable)
+		return
+	}
+	ui.app.QueueUpdateDraw(func() {
+		ui.SetPorts(ports)
+	})
+}
@@ -1,7 +1,7 @@
-package main
-
-import "mytunnel/cmd"
-
-func main() {
-	cmd.Execute()
+package main
+
+import "mytunnel/cmd"
+
+func main() {
+	cmd.Execute()
 } 
\ No newline at end of file